@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// AircraftJSONSource polls the aircraft.json file served by dump1090-fa,
+// readsb and tar1090, typically at http://<receiver>/data/aircraft.json.
+// Receivers report feet, knots and ft/min; they are converted to the metres
+// and m/s used by OpenSky so both feeds can be used interchangeably.
+type AircraftJSONSource struct {
+	client *http.Client
+	url    string
+}
+
+func NewAircraftJSONSource(url string) *AircraftJSONSource {
+	return &AircraftJSONSource{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		url: url,
+	}
+}
+
+func (a *AircraftJSONSource) Name() string {
+	return "aircraftjson"
+}
+
+type aircraftJSON struct {
+	Now      float64           `json:"now"`
+	Aircraft []aircraftJSONRow `json:"aircraft"`
+}
+
+type aircraftJSONRow struct {
+	Hex      string      `json:"hex"`
+	Type     string      `json:"type"`
+	Flight   string      `json:"flight"`
+	Lat      *float64    `json:"lat"`
+	Lon      *float64    `json:"lon"`
+	AltBaro  interface{} `json:"alt_baro"`
+	AltGeom  *float64    `json:"alt_geom"`
+	GS       *float64    `json:"gs"`
+	Track    *float64    `json:"track"`
+	BaroRate *float64    `json:"baro_rate"`
+	GeomRate *float64    `json:"geom_rate"`
+	Squawk   string      `json:"squawk"`
+	Category string      `json:"category"`
+	Seen     *float64    `json:"seen"`
+	SeenPos  *float64    `json:"seen_pos"`
+}
+
+func (a *AircraftJSONSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch aircraft.json: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var body aircraftJSON
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode aircraft.json: %w", err)
+	}
+
+	now := time.Now()
+	if body.Now > 0 {
+		now = unixSeconds(body.Now)
+	}
+
+	flights := make([]types.Flight, 0, len(body.Aircraft))
+	for _, row := range body.Aircraft {
+		if flight, ok := row.toFlight(now); ok {
+			flights = append(flights, flight)
+		}
+	}
+	return flights, nil
+}
+
+// toFlight converts a receiver row. Rows whose address is not an ICAO
+// 24-bit address, marked with a leading "~" (e.g. TIS-B), are skipped.
+func (row aircraftJSONRow) toFlight(now time.Time) (types.Flight, bool) {
+	if row.Hex == "" || strings.HasPrefix(row.Hex, "~") {
+		return types.Flight{}, false
+	}
+
+	flight := types.Flight{
+		ICAO24:         strings.ToLower(row.Hex),
+		Callsign:       strings.TrimSpace(row.Flight),
+		TrueTrack:      row.Track,
+		Squawk:         row.Squawk,
+		Category:       openSkyCategory(row.Category),
+		PositionSource: types.PositionSourceADSB,
+		LastContact:    now,
+		SPIUnknown:     true,
+	}
+	if row.Type == "mlat" {
+		flight.PositionSource = types.PositionSourceMLAT
+	}
+	if row.Seen != nil {
+		flight.LastContact = now.Add(-secondsToDuration(*row.Seen))
+	}
+	flight.LastUpdated = flight.LastContact
+
+	if row.Lat != nil && row.Lon != nil {
+		flight.Latitude = row.Lat
+		flight.Longitude = row.Lon
+		flight.TimePosition = types.Time(flight.LastContact)
+		if row.SeenPos != nil {
+			flight.TimePosition = types.Time(now.Add(-secondsToDuration(*row.SeenPos)))
+		}
+	}
+
+	// The ground state is only known from the barometric altitude, which
+	// reads "ground" for aircraft on the ground.
+	switch alt := row.AltBaro.(type) {
+	case float64:
+		flight.BaroAltitude = types.Float64(alt * feetToMetres)
+	case string:
+		flight.OnGround = alt == "ground"
+	default:
+		flight.OnGroundUnknown = true
+	}
+	if row.AltGeom != nil {
+		flight.GeoAltitude = types.Float64(*row.AltGeom * feetToMetres)
+	}
+	if row.GS != nil {
+		flight.Velocity = types.Float64(*row.GS * knotsToMetresPerS)
+	}
+	if rate := row.BaroRate; rate != nil {
+		flight.VerticalRate = types.Float64(*rate * feetPerMinToMetres)
+	} else if rate := row.GeomRate; rate != nil {
+		flight.VerticalRate = types.Float64(*rate * feetPerMinToMetres)
+	}
+
+	return flight, true
+}
+
+// openSkyCategory maps an ADS-B emitter category such as "A3" onto the
+// numeric aircraft category used by OpenSky.
+func openSkyCategory(category string) int {
+	if len(category) != 2 || category[1] < '0' || category[1] > '7' {
+		return 0
+	}
+	n := int(category[1] - '0')
+	if n == 0 {
+		return 1
+	}
+
+	switch category[0] {
+	case 'A':
+		return 1 + n
+	case 'B':
+		return 8 + n
+	case 'C':
+		if n <= 5 {
+			return 15 + n
+		}
+	}
+	return 0
+}
+
+func unixSeconds(seconds float64) time.Time {
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func TestAircraftJSONSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/aircraft.json")
+	}))
+	defer server.Close()
+
+	flights, err := NewAircraftJSONSource(server.URL).FetchFlights(context.Background())
+	if err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+
+	byICAO := make(map[string]types.Flight)
+	for _, flight := range flights {
+		byICAO[flight.ICAO24] = flight
+	}
+	if len(flights) != 4 {
+		t.Fatalf("Expected 4 flights with ICAO addresses, got %d", len(flights))
+	}
+	if _, ok := byICAO["~2c4f1a"]; ok {
+		t.Error("Expected non-ICAO address to be skipped")
+	}
+
+	now := time.Unix(1719068400, 0)
+	airborne := byICAO["3c6444"]
+	if airborne.Callsign != "DLH7CD" || airborne.Squawk != "1000" {
+		t.Errorf("Unexpected identity: %q %q", airborne.Callsign, airborne.Squawk)
+	}
+	assertClose(t, "baro altitude", airborne.BaroAltitude, 34475*0.3048)
+	assertClose(t, "geo altitude", airborne.GeoAltitude, 35000*0.3048)
+	assertClose(t, "velocity", airborne.Velocity, 448*0.514444)
+	assertClose(t, "vertical rate", airborne.VerticalRate, -960*0.00508)
+	assertClose(t, "track", airborne.TrueTrack, 271.5)
+	if airborne.Category != 4 {
+		t.Errorf("Expected category A3 to map to 4, got %d", airborne.Category)
+	}
+	if !airborne.LastContact.Equal(now.Add(-500 * time.Millisecond)) {
+		t.Errorf("Expected last contact from seen, got %v", airborne.LastContact)
+	}
+	if airborne.TimePosition == nil || !airborne.TimePosition.Equal(now.Add(-1500*time.Millisecond)) {
+		t.Errorf("Expected time position from seen_pos, got %v", airborne.TimePosition)
+	}
+
+	ground := byICAO["4ca2b6"]
+	if !ground.OnGround || ground.BaroAltitude != nil {
+		t.Errorf("Expected alt_baro ground to mark the aircraft on the ground, got %v %v", ground.OnGround, ground.BaroAltitude)
+	}
+	if ground.Category != 6 {
+		t.Errorf("Expected category A5 to map to 6, got %d", ground.Category)
+	}
+
+	if byICAO["a1b2c3"].PositionSource != types.PositionSourceMLAT {
+		t.Error("Expected mlat rows to report an MLAT position source")
+	}
+
+	noPosition := byICAO["d4e5f6"]
+	if noPosition.HasPosition() || noPosition.Velocity != nil {
+		t.Error("Expected missing fields to stay unknown")
+	}
+}
+
+func TestAircraftJSONGroundState(t *testing.T) {
+	now := time.Unix(1719068400, 0)
+	if flight, _ := (aircraftJSONRow{Hex: "3c6444", AltBaro: 34475.0}).toFlight(now); flight.OnGroundUnknown || flight.OnGround {
+		t.Error("Expected a barometric altitude to mark the aircraft airborne")
+	}
+	if flight, _ := (aircraftJSONRow{Hex: "3c6444"}).toFlight(now); !flight.OnGroundUnknown {
+		t.Error("Expected the ground state to be unknown without alt_baro")
+	}
+}
+
+func TestOpenSkyCategory(t *testing.T) {
+	tests := map[string]int{"": 0, "A0": 1, "A1": 2, "A7": 8, "B1": 9, "B7": 15, "C1": 16, "C5": 20, "C7": 0, "D1": 0, "A9": 0}
+	for category, want := range tests {
+		if got := openSkyCategory(category); got != want {
+			t.Errorf("Category %q: expected %d, got %d", category, want, got)
+		}
+	}
+}
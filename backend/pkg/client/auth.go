@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenSource obtains and caches OAuth2 access tokens using the client
+// credentials grant.
+type tokenSource struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mu      sync.Mutex
+	access  string
+	expires time.Time
+}
+
+func newTokenSource(client *http.Client, tokenURL, clientID, clientSecret string) *tokenSource {
+	return &tokenSource{
+		client:       client,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// token returns a cached access token, refreshing it shortly before it
+// expires.
+func (t *tokenSource) token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.access != "" && time.Now().Before(t.expires) {
+		return t.access, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {t.clientID},
+		"client_secret": {t.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access token")
+	}
+
+	// Refresh a little early so a token never expires mid-request.
+	lifetime := time.Duration(body.ExpiresIn)*time.Second - 30*time.Second
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	t.access = body.AccessToken
+	t.expires = time.Now().Add(lifetime)
+	return t.access, nil
+}
+
+// invalidate drops the cached token, forcing the next request to fetch a
+// new one.
+func (t *tokenSource) invalidate() {
+	t.mu.Lock()
+	t.access = ""
+	t.mu.Unlock()
+}
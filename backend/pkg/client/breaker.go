@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// ErrCircuitOpen is returned instead of calling the upstream while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker opens after a run of consecutive failures and rejects
+// calls until openTimeout has passed. It then lets a single probe through
+// in the half-open state: success closes the circuit, failure re-opens it.
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	onChange    func(BreakerState)
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed breaker. onChange, if not nil, is
+// called with the new state on every transition.
+func NewCircuitBreaker(threshold int, openTimeout time.Duration, onChange func(BreakerState)) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		onChange:    onChange,
+		now:         time.Now,
+	}
+}
+
+// Allow reports whether a call may proceed, moving an open breaker to
+// half-open once its timeout has elapsed.
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openTimeout {
+			return ErrCircuitOpen
+		}
+		cb.setState(BreakerHalfOpen)
+		cb.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.probing = false
+	if cb.state != BreakerClosed {
+		cb.setState(BreakerClosed)
+	}
+}
+
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.probing = false
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.threshold {
+		cb.openedAt = cb.now()
+		if cb.state != BreakerOpen {
+			cb.setState(BreakerOpen)
+		}
+	}
+}
+
+// abort releases a half-open probe without recording a result.
+func (cb *CircuitBreaker) abort() {
+	cb.mu.Lock()
+	cb.probing = false
+	cb.mu.Unlock()
+}
+
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// RetryIn returns how long an open breaker will keep rejecting calls.
+func (cb *CircuitBreaker) RetryIn() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != BreakerOpen {
+		return 0
+	}
+	if wait := cb.openTimeout - cb.now().Sub(cb.openedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (cb *CircuitBreaker) setState(state BreakerState) {
+	cb.state = state
+	if cb.onChange != nil {
+		cb.onChange(state)
+	}
+}
+
+// BreakerSource guards a Source with a CircuitBreaker.
+type BreakerSource struct {
+	source  Source
+	breaker *CircuitBreaker
+}
+
+func NewBreakerSource(source Source, breaker *CircuitBreaker) *BreakerSource {
+	return &BreakerSource{source: source, breaker: breaker}
+}
+
+func (b *BreakerSource) Name() string {
+	return b.source.Name()
+}
+
+func (b *BreakerSource) Breaker() *CircuitBreaker {
+	return b.breaker
+}
+
+func (b *BreakerSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	if err := b.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	flights, err := b.source.FetchFlights(ctx)
+	if err != nil {
+		// A cancelled fetch says nothing about the health of the upstream.
+		if ctx.Err() != nil {
+			b.breaker.abort()
+		} else {
+			b.breaker.Failure()
+		}
+		return nil, err
+	}
+	b.breaker.Success()
+	return flights, nil
+}
+
+// StreamFlights streams from the wrapped source through the breaker, so
+// that polled sources keep emitting flights as they are decoded. Sources
+// that cannot stream are fetched whole and emitted afterwards. An error
+// returned by emit says nothing about the upstream and is not counted as a
+// failure.
+func (b *BreakerSource) StreamFlights(ctx context.Context, emit func(types.Flight) error) error {
+	streamer, ok := b.source.(Streamer)
+	if !ok {
+		flights, err := b.FetchFlights(ctx)
+		if err != nil {
+			return err
+		}
+		for _, flight := range flights {
+			if err := emit(flight); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := b.breaker.Allow(); err != nil {
+		return err
+	}
+	var emitErr error
+	err := streamer.StreamFlights(ctx, func(flight types.Flight) error {
+		emitErr = emit(flight)
+		return emitErr
+	})
+	switch {
+	case err == nil:
+		b.breaker.Success()
+	case emitErr != nil || ctx.Err() != nil:
+		b.breaker.abort()
+	default:
+		b.breaker.Failure()
+	}
+	return err
+}
+
+// NextPoll waits out an open breaker and otherwise defers to the wrapped
+// source.
+func (b *BreakerSource) NextPoll(base time.Duration) time.Duration {
+	delay := base
+	if advisor, ok := b.source.(PollAdvisor); ok {
+		delay = advisor.NextPoll(base)
+	}
+	if wait := b.breaker.RetryIn(); wait > delay {
+		delay = wait
+	}
+	return delay
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// fakeUpstream serves an empty flight list, or 503 while failing is set.
+type fakeUpstream struct {
+	server   *httptest.Server
+	failing  int32
+	requests int32
+}
+
+func newFakeUpstream() *fakeUpstream {
+	u := &fakeUpstream{}
+	u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&u.requests, 1)
+		if atomic.LoadInt32(&u.failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	return u
+}
+
+func (u *fakeUpstream) setFailing(failing bool) {
+	var v int32
+	if failing {
+		v = 1
+	}
+	atomic.StoreInt32(&u.failing, v)
+}
+
+func (u *fakeUpstream) requestCount() int {
+	return int(atomic.LoadInt32(&u.requests))
+}
+
+func TestBreakerSourceFailingAndRecovering(t *testing.T) {
+	upstream := newFakeUpstream()
+	defer upstream.server.Close()
+
+	now := time.Date(2024, 6, 22, 12, 0, 0, 0, time.UTC)
+	var transitions []BreakerState
+	breaker := NewCircuitBreaker(3, time.Minute, func(state BreakerState) {
+		transitions = append(transitions, state)
+	})
+	breaker.now = func() time.Time { return now }
+	source := NewBreakerSource(NewHTTPSource(upstream.server.URL), breaker)
+
+	// The upstream goes down: the breaker opens after three failures.
+	upstream.setFailing(true)
+	for i := 0; i < 3; i++ {
+		if _, err := source.FetchFlights(context.Background()); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("Expected upstream error on attempt %d, got %v", i+1, err)
+		}
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected breaker to be open, got %s", breaker.State())
+	}
+
+	// While open, calls are rejected without reaching the upstream.
+	if _, err := source.FetchFlights(context.Background()); err != ErrCircuitOpen {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if upstream.requestCount() != 3 {
+		t.Errorf("Expected 3 upstream requests, got %d", upstream.requestCount())
+	}
+	if delay := source.NextPoll(15 * time.Second); delay != time.Minute {
+		t.Errorf("Expected next poll after the open timeout, got %v", delay)
+	}
+
+	// After the timeout a single probe is let through and fails again.
+	now = now.Add(time.Minute)
+	if _, err := source.FetchFlights(context.Background()); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("Expected failed probe, got %v", err)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected failed probe to re-open the breaker, got %s", breaker.State())
+	}
+
+	// The upstream recovers: the next probe closes the breaker.
+	upstream.setFailing(false)
+	now = now.Add(time.Minute)
+	if _, err := source.FetchFlights(context.Background()); err != nil {
+		t.Fatalf("Expected successful probe, got %v", err)
+	}
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("Expected breaker to close after a successful probe, got %s", breaker.State())
+	}
+	if upstream.requestCount() != 5 {
+		t.Errorf("Expected 5 upstream requests, got %d", upstream.requestCount())
+	}
+
+	expected := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected transitions %v, got %v", expected, transitions)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Second, nil)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	now = now.Add(time.Second)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected concurrent call during probe to be rejected, got %v", err)
+	}
+}
+
+// streamingSource emits its flights and then fails with err.
+type streamingSource struct {
+	flights []types.Flight
+	err     error
+}
+
+func (s *streamingSource) Name() string {
+	return "streaming"
+}
+
+func (s *streamingSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	return collectFlights(ctx, s.StreamFlights)
+}
+
+func (s *streamingSource) StreamFlights(ctx context.Context, emit func(types.Flight) error) error {
+	for _, flight := range s.flights {
+		if err := emit(flight); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func TestBreakerSourceStreamsFlights(t *testing.T) {
+	upstream := &streamingSource{flights: []types.Flight{{ICAO24: "3c6444"}, {ICAO24: "4ca2b6"}}}
+	breaker := NewCircuitBreaker(1, time.Minute, nil)
+	source := NewBreakerSource(upstream, breaker)
+
+	var emitted []string
+	err := source.StreamFlights(context.Background(), func(flight types.Flight) error {
+		emitted = append(emitted, flight.ICAO24)
+		return nil
+	})
+	if err != nil || len(emitted) != 2 {
+		t.Fatalf("Expected both flights to be streamed, got %v: %v", emitted, err)
+	}
+
+	// Failing to handle a flight is not the upstream's fault.
+	rejected := errors.New("store unavailable")
+	err = source.StreamFlights(context.Background(), func(types.Flight) error { return rejected })
+	if err != rejected || breaker.State() != BreakerClosed {
+		t.Fatalf("Expected the emit error with a closed breaker, got %v and %s", err, breaker.State())
+	}
+
+	// A stream that breaks off is a failure of the upstream.
+	upstream.err = errors.New("connection reset")
+	if err := source.StreamFlights(context.Background(), func(types.Flight) error { return nil }); err != upstream.err {
+		t.Fatalf("Expected the upstream error, got %v", err)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected the failed stream to open the breaker, got %s", breaker.State())
+	}
+	if err := source.StreamFlights(context.Background(), func(types.Flight) error { return nil }); err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestBreakerSourceStreamsFetchedFlights(t *testing.T) {
+	upstream := newFakeUpstream()
+	defer upstream.server.Close()
+	source := NewBreakerSource(NewHTTPSource(upstream.server.URL), NewCircuitBreaker(1, time.Minute, nil))
+
+	if err := source.StreamFlights(context.Background(), func(types.Flight) error { return nil }); err != nil {
+		t.Fatalf("Expected a source without streaming to be fetched, got %v", err)
+	}
+	upstream.setFailing(true)
+	source.StreamFlights(context.Background(), func(types.Flight) error { return nil })
+	if source.Breaker().State() != BreakerOpen {
+		t.Errorf("Expected the failed fetch to open the breaker, got %s", source.Breaker().State())
+	}
+}
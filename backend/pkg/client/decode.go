@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// decodeStates streams an OpenSky /states response, calling emit for each
+// state vector as soon as it has been decoded. Only one row is held in
+// memory at a time, so a global response never has to be buffered whole.
+func decodeStates(ctx context.Context, r io.Reader, emit func(types.Flight) error) error {
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		if key, _ := token.(string); key != "states" {
+			// Skip the value of any other field, such as "time".
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			continue
+		}
+
+		if err := decodeStateRows(ctx, dec, emit); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeStateRows decodes the "states" array row by row. OpenSky sends
+// null instead of an empty array when nothing matches the query.
+func decodeStateRows(ctx context.Context, dec *json.Decoder, emit func(types.Flight) error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to decode states: %w", err)
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("failed to decode states: unexpected token %v", token)
+	}
+
+	var row []interface{}
+	for dec.More() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row = row[:0]
+		if err := dec.Decode(&row); err != nil {
+			return fmt.Errorf("failed to decode state: %w", err)
+		}
+
+		flight, ok := parseState(row)
+		if !ok {
+			continue
+		}
+		if err := emit(flight); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("failed to decode response: expected %v, got %v", want, token)
+	}
+	return nil
+}
+
+// collectFlights drains a stream into a slice, for the FetchFlights side of
+// sources that implement Streamer.
+func collectFlights(ctx context.Context, stream func(context.Context, func(types.Flight) error) error) ([]types.Flight, error) {
+	var flights []types.Flight
+	err := stream(ctx, func(flight types.Flight) error {
+		flights = append(flights, flight)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flights, nil
+}
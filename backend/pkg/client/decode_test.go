@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+const (
+	recordedResponse = "../../docs/openskyapi_response.json"
+	globalResponse   = "../../docs/openskyapi._response.json"
+)
+
+func TestDecodeStatesStreamsRows(t *testing.T) {
+	body, err := os.ReadFile(recordedResponse)
+	if err != nil {
+		t.Fatalf("Failed to read recorded response: %v", err)
+	}
+
+	var icao24s []string
+	err = decodeStates(context.Background(), bytes.NewReader(body), func(flight types.Flight) error {
+		icao24s = append(icao24s, flight.ICAO24)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeStates returned error: %v", err)
+	}
+
+	expected := []string{"3c6444", "4ca2b6", "a1b2c3", "d4e5f6", "g7h8i9"}
+	if strings.Join(icao24s, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, icao24s)
+	}
+}
+
+func TestDecodeStatesNullStates(t *testing.T) {
+	calls := 0
+	err := decodeStates(context.Background(), strings.NewReader(`{"time": 1719068400, "states": null}`), func(types.Flight) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeStates returned error: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no flights, got %d", calls)
+	}
+}
+
+func TestDecodeStatesStopsOnEmitError(t *testing.T) {
+	body, _ := os.ReadFile(recordedResponse)
+	stop := errors.New("stop")
+
+	calls := 0
+	err := decodeStates(context.Background(), bytes.NewReader(body), func(types.Flight) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Expected emit error to be returned, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected decoding to stop after the first flight, got %d calls", calls)
+	}
+}
+
+func TestDecodeStatesMalformed(t *testing.T) {
+	for _, body := range []string{`[]`, `{"states": {}}`, `{"states": [["abc"`} {
+		err := decodeStates(context.Background(), strings.NewReader(body), func(types.Flight) error { return nil })
+		if err == nil {
+			t.Errorf("Expected error for %q", body)
+		}
+	}
+}
+
+func TestFetchFlightsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{BaseURL: server.URL})
+	if _, err := fetcher.FetchFlights(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// decodeStatesBuffered is the previous approach of decoding the whole
+// response before converting it, kept as a baseline for the benchmarks.
+func decodeStatesBuffered(body []byte) ([]types.Flight, error) {
+	var response struct {
+		States [][]interface{} `json:"states"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	flights := make([]types.Flight, 0, len(response.States))
+	for _, state := range response.States {
+		if flight, ok := parseState(state); ok {
+			flights = append(flights, flight)
+		}
+	}
+	return flights, nil
+}
+
+func benchmarkDecodeStates(b *testing.B, path string) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatalf("Failed to read recorded response: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := decodeStates(context.Background(), bytes.NewReader(body), func(types.Flight) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecodeStatesBuffered(b *testing.B, path string) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatalf("Failed to read recorded response: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeStatesBuffered(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStates(b *testing.B) {
+	benchmarkDecodeStates(b, recordedResponse)
+}
+
+func BenchmarkDecodeStatesBuffered(b *testing.B) {
+	benchmarkDecodeStatesBuffered(b, recordedResponse)
+}
+
+func BenchmarkDecodeStatesGlobal(b *testing.B) {
+	benchmarkDecodeStates(b, globalResponse)
+}
+
+func BenchmarkDecodeStatesGlobalBuffered(b *testing.B) {
+	benchmarkDecodeStatesBuffered(b, globalResponse)
+}
@@ -1,67 +1,253 @@
 package client
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/observability"
 	"github.com/real-time-dashboard/backend/pkg/types"
 )
 
+// Indexes of the fields in an OpenSky state vector. Category is only
+// present when the request is made with extended=1.
+const (
+	stateICAO24 = iota
+	stateCallsign
+	stateOriginCountry
+	stateTimePosition
+	stateLastContact
+	stateLongitude
+	stateLatitude
+	stateBaroAltitude
+	stateOnGround
+	stateVelocity
+	stateTrueTrack
+	stateVerticalRate
+	stateSensors
+	stateGeoAltitude
+	stateSquawk
+	stateSPI
+	statePositionSource
+	stateCategory
+)
+
+// OpenSkyOptions configures a FlightFetcher. Credentials are optional;
+// when both are set, OAuth client credentials take precedence over basic
+// auth.
+type OpenSkyOptions struct {
+	BaseURL      string
+	Username     string
+	Password     string
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
+	BBox         *geo.BBox
+	ICAO24       []string
+	Extended     bool
+}
+
+// FlightFetcher polls the OpenSky REST API for state vectors. It tracks
+// the rate limit headers of every response so that the poll interval can
+// be stretched to stay within the daily credit allowance.
 type FlightFetcher struct {
 	client  *http.Client
 	baseURL string
+	opts    OpenSkyOptions
+	tokens  *tokenSource
+
+	mu        sync.Mutex
+	remaining int
+	retryAt   time.Time
+	now       func() time.Time
 }
 
-func NewFlightFetcher() *FlightFetcher {
-	return &FlightFetcher{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		baseURL: "https://opensky-network.org/api/states/all",
+func NewFlightFetcher(opts OpenSkyOptions) *FlightFetcher {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	f := &FlightFetcher{
+		client:    client,
+		baseURL:   opts.BaseURL,
+		opts:      opts,
+		remaining: -1,
+		now:       time.Now,
 	}
+	if opts.ClientID != "" && opts.ClientSecret != "" {
+		f.tokens = newTokenSource(client, opts.TokenURL, opts.ClientID, opts.ClientSecret)
+	}
+	return f
+}
+
+func (f *FlightFetcher) Name() string {
+	return "opensky"
+}
+
+func (f *FlightFetcher) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	return collectFlights(ctx, f.StreamFlights)
 }
 
-func (f *FlightFetcher) FetchFlights() ([]types.Flight, error) {
-	resp, err := f.client.Get(f.baseURL)
+// StreamFlights requests the current states and calls emit for each flight
+// while the response is still being read.
+func (f *FlightFetcher) StreamFlights(ctx context.Context, emit func(types.Flight) error) error {
+	req, err := f.newRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch flights: %w", err)
+		return fmt.Errorf("failed to fetch flights: %w", err)
 	}
 	defer resp.Body.Close()
 
+	f.recordRateLimit(resp)
+
+	if resp.StatusCode == http.StatusUnauthorized && f.tokens != nil {
+		f.tokens.invalidate()
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return newStatusError(resp)
 	}
 
-	var response struct {
-		States [][]interface{} `json:"states"`
+	return decodeStates(ctx, resp.Body, emit)
+}
+
+// newRequest builds the /states request with the configured query
+// parameters and credentials.
+func (f *FlightFetcher) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	query := req.URL.Query()
+	if box := f.opts.BBox; box != nil {
+		query.Set("lamin", strconv.FormatFloat(box.MinLat, 'f', -1, 64))
+		query.Set("lomin", strconv.FormatFloat(box.MinLon, 'f', -1, 64))
+		query.Set("lamax", strconv.FormatFloat(box.MaxLat, 'f', -1, 64))
+		query.Set("lomax", strconv.FormatFloat(box.MaxLon, 'f', -1, 64))
+	}
+	for _, icao24 := range f.opts.ICAO24 {
+		query.Add("icao24", strings.ToLower(icao24))
 	}
+	if f.opts.Extended {
+		query.Set("extended", "1")
+	}
+	req.URL.RawQuery = query.Encode()
 
-	flights := make([]types.Flight, 0, len(response.States))
-	for _, state := range response.States {
-		if len(state) < 10 {
-			continue
+	switch {
+	case f.tokens != nil:
+		token, err := f.tokens.token(ctx)
+		if err != nil {
+			return nil, err
 		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case f.opts.Username != "":
+		req.SetBasicAuth(f.opts.Username, f.opts.Password)
+	}
 
-		flight := types.Flight{
-			ICAO24:        getString(state[0]),
-			Callsign:      getString(state[1]),
-			OriginCountry: getString(state[2]),
-			Longitude:     getFloat64(state[5]),
-			Latitude:      getFloat64(state[6]),
-			OnGround:      getBool(state[8]),
-			Velocity:      getFloat64(state[9]),
-			LastUpdated:   time.Now(),
-		}
+	return req, nil
+}
 
-		flights = append(flights, flight)
+func (f *FlightFetcher) recordRateLimit(resp *http.Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining")); err == nil {
+		f.remaining = remaining
+		observability.OpenSkyCreditsRemaining.Set(float64(remaining))
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Retry-After-Seconds")); err == nil {
+		f.retryAt = f.now().Add(time.Duration(seconds) * time.Second)
 	}
+}
 
-	return flights, nil
+// requestCost returns the number of API credits a single /states/all
+// request consumes, which OpenSky derives from the queried area.
+func (f *FlightFetcher) requestCost() int {
+	if f.opts.BBox == nil {
+		return 4
+	}
+	switch area := f.opts.BBox.Area(); {
+	case area <= 25:
+		return 1
+	case area <= 100:
+		return 2
+	case area <= 400:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// NextPoll returns how long to wait before the next request. It honours
+// X-Rate-Limit-Retry-After-Seconds and otherwise spreads the remaining
+// credits evenly until they are replenished at midnight UTC, never polling
+// faster than base.
+func (f *FlightFetcher) NextPoll(base time.Duration) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if wait := f.retryAt.Sub(now); wait > base {
+		return wait
+	}
+	if f.remaining < 0 {
+		return base
+	}
+
+	untilReset := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	requests := f.remaining / f.requestCost()
+	if requests == 0 {
+		return untilReset
+	}
+	if spread := untilReset / time.Duration(requests); spread > base {
+		return spread
+	}
+	return base
+}
+
+// parseState maps a single OpenSky state vector onto a Flight. It reports
+// false for rows that are too short to be a state vector.
+func parseState(state []interface{}) (types.Flight, bool) {
+	if len(state) <= statePositionSource {
+		return types.Flight{}, false
+	}
+
+	flight := types.Flight{
+		ICAO24:         getString(state[stateICAO24]),
+		Callsign:       strings.TrimSpace(getString(state[stateCallsign])),
+		OriginCountry:  getString(state[stateOriginCountry]),
+		TimePosition:   getTimePtr(state[stateTimePosition]),
+		LastContact:    getTime(state[stateLastContact]),
+		Longitude:      getFloat64(state[stateLongitude]),
+		Latitude:       getFloat64(state[stateLatitude]),
+		BaroAltitude:   getFloat64(state[stateBaroAltitude]),
+		OnGround:       getBool(state[stateOnGround]),
+		Velocity:       getFloat64(state[stateVelocity]),
+		TrueTrack:      getFloat64(state[stateTrueTrack]),
+		VerticalRate:   getFloat64(state[stateVerticalRate]),
+		Sensors:        getInts(state[stateSensors]),
+		GeoAltitude:    getFloat64(state[stateGeoAltitude]),
+		Squawk:         getString(state[stateSquawk]),
+		SPI:            getBool(state[stateSPI]),
+		PositionSource: getInt(state[statePositionSource]),
+	}
+	if len(state) > stateCategory {
+		flight.Category = getInt(state[stateCategory])
+	}
+
+	flight.LastUpdated = flight.LastContact
+	if flight.LastUpdated.IsZero() {
+		flight.LastUpdated = time.Now()
+	}
+
+	return flight, true
 }
 
 func getString(v interface{}) string {
@@ -71,9 +257,18 @@ func getString(v interface{}) string {
 	return ""
 }
 
-func getFloat64(v interface{}) float64 {
+// getFloat64 returns nil for null values so that unknown readings are not
+// mistaken for zero.
+func getFloat64(v interface{}) *float64 {
 	if f, ok := v.(float64); ok {
-		return f
+		return &f
+	}
+	return nil
+}
+
+func getInt(v interface{}) int {
+	if f, ok := v.(float64); ok {
+		return int(f)
 	}
 	return 0
 }
@@ -83,4 +278,33 @@ func getBool(v interface{}) bool {
 		return b
 	}
 	return false
-}
\ No newline at end of file
+}
+
+// getTime converts a Unix timestamp in seconds to a time.Time.
+func getTime(v interface{}) time.Time {
+	if f, ok := v.(float64); ok {
+		return time.Unix(int64(f), 0).UTC()
+	}
+	return time.Time{}
+}
+
+func getTimePtr(v interface{}) *time.Time {
+	if t := getTime(v); !t.IsZero() {
+		return &t
+	}
+	return nil
+}
+
+func getInts(v interface{}) []int {
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	ints := make([]int, 0, len(values))
+	for _, value := range values {
+		if f, ok := value.(float64); ok {
+			ints = append(ints, int(f))
+		}
+	}
+	return ints
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFetchFlightsParsesFullStateVector(t *testing.T) {
+	body, err := os.ReadFile("../../docs/openskyapi_response.json")
+	if err != nil {
+		t.Fatalf("Failed to read recorded response: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{BaseURL: server.URL})
+
+	flights, err := fetcher.FetchFlights(context.Background())
+	if err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+
+	if len(flights) != 5 {
+		t.Fatalf("Expected 5 flights, got %d", len(flights))
+	}
+
+	flight := flights[0]
+	if flight.ICAO24 != "3c6444" {
+		t.Errorf("Expected ICAO24 3c6444, got %s", flight.ICAO24)
+	}
+	if flight.Callsign != "DLH7CD" {
+		t.Errorf("Expected trimmed callsign DLH7CD, got %q", flight.Callsign)
+	}
+	if flight.BaroAltitude == nil || *flight.BaroAltitude != 10500.0 {
+		t.Errorf("Expected BaroAltitude 10500, got %v", flight.BaroAltitude)
+	}
+	if flight.TrueTrack == nil || *flight.TrueTrack != 270.0 {
+		t.Errorf("Expected TrueTrack 270, got %v", flight.TrueTrack)
+	}
+	if flight.VerticalRate == nil || *flight.VerticalRate != -512.0 {
+		t.Errorf("Expected VerticalRate -512, got %v", flight.VerticalRate)
+	}
+	if flight.GeoAltitude == nil || *flight.GeoAltitude != 10668.0 {
+		t.Errorf("Expected GeoAltitude 10668, got %v", flight.GeoAltitude)
+	}
+	if flight.Squawk != "1000" {
+		t.Errorf("Expected Squawk 1000, got %s", flight.Squawk)
+	}
+
+	lastContact := time.Unix(1719068399, 0)
+	if !flight.LastContact.Equal(lastContact) {
+		t.Errorf("Expected LastContact %v, got %v", lastContact, flight.LastContact)
+	}
+	if !flight.LastUpdated.Equal(lastContact) {
+		t.Errorf("Expected LastUpdated to match last_contact, got %v", flight.LastUpdated)
+	}
+}
+
+func TestParseStateExtended(t *testing.T) {
+	state := []interface{}{
+		"4ca2b6", "UAL123  ", "United States", 1719068398.0, 1719068399.0,
+		-122.4194, 37.7749, 8500.0, false, 180.5, 90.0, 256.0,
+		[]interface{}{12.0, 34.0}, 8668.0, "7700", true, 2.0, 4.0,
+	}
+
+	flight, ok := parseState(state)
+	if !ok {
+		t.Fatal("Expected state to parse")
+	}
+
+	if len(flight.Sensors) != 2 || flight.Sensors[1] != 34 {
+		t.Errorf("Expected sensors [12 34], got %v", flight.Sensors)
+	}
+	if !flight.SPI {
+		t.Error("Expected SPI true")
+	}
+	if flight.PositionSource != 2 {
+		t.Errorf("Expected PositionSource 2, got %d", flight.PositionSource)
+	}
+	if flight.Category != 4 {
+		t.Errorf("Expected Category 4, got %d", flight.Category)
+	}
+	if flight.TimePosition == nil || !flight.TimePosition.Equal(time.Unix(1719068398, 0)) {
+		t.Errorf("Unexpected TimePosition %v", flight.TimePosition)
+	}
+}
+
+func TestParseStateKeepsNullsUnknown(t *testing.T) {
+	state := []interface{}{
+		"3ffc26", nil, "Germany", nil, 1750587823.0,
+		nil, nil, nil, false, nil, nil, nil,
+		nil, nil, nil, false, 0.0,
+	}
+
+	flight, ok := parseState(state)
+	if !ok {
+		t.Fatal("Expected state to parse")
+	}
+
+	if flight.HasPosition() {
+		t.Error("Expected flight without coordinates to have no position")
+	}
+	if flight.Velocity != nil || flight.BaroAltitude != nil || flight.TrueTrack != nil {
+		t.Error("Expected null readings to stay unknown")
+	}
+	if flight.TimePosition != nil {
+		t.Errorf("Expected unknown TimePosition, got %v", flight.TimePosition)
+	}
+}
+
+func TestParseStateTooShort(t *testing.T) {
+	if _, ok := parseState([]interface{}{"abc123", "TEST"}); ok {
+		t.Error("Expected short state to be rejected")
+	}
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// FileSource replays recorded OpenSky responses from a directory. Every
+// fetch returns the next *.json snapshot in name order, wrapping around
+// after the last one, so a capture can be played back indefinitely.
+type FileSource struct {
+	dir  string
+	mu   sync.Mutex
+	next int
+}
+
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{dir: dir}
+}
+
+func (f *FileSource) Name() string {
+	return "file"
+}
+
+func (f *FileSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	return collectFlights(ctx, f.StreamFlights)
+}
+
+// StreamFlights decodes the next snapshot, calling emit for each flight.
+func (f *FileSource) StreamFlights(ctx context.Context, emit func(types.Flight) error) error {
+	files, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no snapshots found in %s", f.dir)
+	}
+	sort.Strings(files)
+
+	f.mu.Lock()
+	path := files[f.next%len(files)]
+	f.next = (f.next + 1) % len(files)
+	f.mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	return decodeStates(ctx, file, emit)
+}
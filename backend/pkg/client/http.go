@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// HTTPSource polls a URL that serves a JSON array of types.Flight, such as
+// the /flights endpoint of mock-data-service or another flight-data-service.
+// Paged responses are followed through their X-Next-Cursor header.
+type HTTPSource struct {
+	client *http.Client
+	url    string
+}
+
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		url: url,
+	}
+}
+
+func (h *HTTPSource) Name() string {
+	return "http"
+}
+
+func (h *HTTPSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	var flights []types.Flight
+	cursor := ""
+	for {
+		page, next, err := h.fetchPage(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		flights = append(flights, page...)
+		if next == "" {
+			return flights, nil
+		}
+		if next == cursor {
+			return nil, fmt.Errorf("cursor %q did not advance", next)
+		}
+		cursor = next
+	}
+}
+
+// fetchPage fetches the page after cursor and returns the cursor of the
+// next page, which is empty on the last one.
+func (h *HTTPSource) fetchPage(ctx context.Context, cursor string) ([]types.Flight, string, error) {
+	target, err := url.Parse(h.url)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if cursor != "" {
+		query := target.Query()
+		query.Set("cursor", cursor)
+		target.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch flights: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newStatusError(resp)
+	}
+
+	var flights []types.Flight
+	if err := json.NewDecoder(resp.Body).Decode(&flights); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return flights, resp.Header.Get("X-Next-Cursor"), nil
+}
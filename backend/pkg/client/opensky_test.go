@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+)
+
+const emptyStates = `{"time": 1719068400, "states": []}`
+
+func TestFlightFetcherQueryParameters(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(emptyStates))
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{
+		BaseURL:  server.URL,
+		BBox:     &geo.BBox{MinLat: 35, MinLon: -10, MaxLat: 71, MaxLon: 40},
+		ICAO24:   []string{"3C6444", "4ca2b6"},
+		Extended: true,
+	})
+	if _, err := fetcher.FetchFlights(context.Background()); err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+
+	expected := map[string]string{"lamin": "35", "lomin": "-10", "lamax": "71", "lomax": "40", "extended": "1"}
+	for key, value := range expected {
+		if got := query[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("Expected %s=%s, got %v", key, value, got)
+		}
+	}
+
+	if got := query["icao24"]; len(got) != 2 || got[0] != "3c6444" || got[1] != "4ca2b6" {
+		t.Errorf("Expected lower-cased icao24 parameters, got %v", got)
+	}
+}
+
+func TestFlightFetcherBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(emptyStates))
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{BaseURL: server.URL, Username: "alice", Password: "secret"})
+	if _, err := fetcher.FetchFlights(context.Background()); err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+}
+
+func TestFlightFetcherClientCredentials(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "dashboard" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tokenRequests++
+		w.Write([]byte(`{"access_token": "token-1", "expires_in": 1800}`))
+	}))
+	defer tokenServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(emptyStates))
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{
+		BaseURL:      server.URL,
+		ClientID:     "dashboard",
+		ClientSecret: "secret",
+		TokenURL:     tokenServer.URL,
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.FetchFlights(context.Background()); err != nil {
+			t.Fatalf("FetchFlights returned error: %v", err)
+		}
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("Expected the access token to be cached, got %d token requests", tokenRequests)
+	}
+}
+
+func TestFlightFetcherRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit-Retry-After-Seconds", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	fetcher := NewFlightFetcher(OpenSkyOptions{BaseURL: server.URL})
+	_, err := fetcher.FetchFlights(context.Background())
+
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("Expected *StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 120*time.Second {
+		t.Errorf("Unexpected status error: %+v", statusErr)
+	}
+
+	if delay := fetcher.NextPoll(15 * time.Second); delay < 119*time.Second {
+		t.Errorf("Expected next poll to wait for the retry-after period, got %v", delay)
+	}
+}
+
+func TestFlightFetcherNextPollSpreadsCredits(t *testing.T) {
+	fetcher := NewFlightFetcher(OpenSkyOptions{
+		BBox: &geo.BBox{MinLat: 45, MinLon: 0, MaxLat: 50, MaxLon: 5},
+	})
+	fetcher.now = func() time.Time {
+		return time.Date(2024, 6, 22, 12, 0, 0, 0, time.UTC)
+	}
+
+	if delay := fetcher.NextPoll(15 * time.Second); delay != 15*time.Second {
+		t.Errorf("Expected base interval without rate limit information, got %v", delay)
+	}
+
+	// 12 hours left and 240 one-credit requests remaining: one every 3 minutes.
+	fetcher.remaining = 240
+	if delay := fetcher.NextPoll(15 * time.Second); delay != 3*time.Minute {
+		t.Errorf("Expected 3m between polls, got %v", delay)
+	}
+
+	fetcher.remaining = 100000
+	if delay := fetcher.NextPoll(15 * time.Second); delay != 15*time.Second {
+		t.Errorf("Expected base interval with plenty of credits, got %v", delay)
+	}
+
+	fetcher.remaining = 0
+	if delay := fetcher.NextPoll(15 * time.Second); delay != 12*time.Hour {
+		t.Errorf("Expected to wait for the daily reset, got %v", delay)
+	}
+}
+
+func TestFlightFetcherRequestCost(t *testing.T) {
+	tests := []struct {
+		box  *geo.BBox
+		cost int
+	}{
+		{box: nil, cost: 4},
+		{box: &geo.BBox{MinLat: 0, MinLon: 0, MaxLat: 5, MaxLon: 5}, cost: 1},
+		{box: &geo.BBox{MinLat: 0, MinLon: 0, MaxLat: 10, MaxLon: 10}, cost: 2},
+		{box: &geo.BBox{MinLat: 0, MinLon: 0, MaxLat: 20, MaxLon: 20}, cost: 3},
+		{box: &geo.BBox{MinLat: 35, MinLon: -10, MaxLat: 71, MaxLon: 40}, cost: 4},
+	}
+
+	for _, tt := range tests {
+		fetcher := NewFlightFetcher(OpenSkyOptions{BBox: tt.box})
+		if cost := fetcher.requestCost(); cost != tt.cost {
+			t.Errorf("Expected cost %d for %v, got %d", tt.cost, tt.box, cost)
+		}
+	}
+}
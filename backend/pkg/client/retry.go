@@ -0,0 +1,51 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries. Jitter is
+// the fraction of each delay that is randomised, so that replicas which
+// failed together do not retry in lockstep.
+type Backoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewBackoff(base, max time.Duration) *Backoff {
+	return &Backoff{
+		Base:       base,
+		Max:        max,
+		Multiplier: 2,
+		Jitter:     0.2,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Delay returns the wait before the given retry attempt, starting at 1.
+// A zero Max leaves the delay uncapped.
+func (b *Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(b.Base) * math.Pow(b.Multiplier, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		b.mu.Lock()
+		delay -= delay * b.Jitter * b.rand.Float64()
+		b.mu.Unlock()
+	}
+	return time.Duration(delay)
+}
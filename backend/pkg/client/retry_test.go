@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := NewBackoff(time.Second, 10*time.Second)
+	backoff.Jitter = 0
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if got := backoff.Delay(i + 1); got != want {
+			t.Errorf("Attempt %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	backoff := NewBackoff(time.Second, time.Minute)
+	backoff.Jitter = 0.5
+
+	for i := 0; i < 100; i++ {
+		delay := backoff.Delay(3)
+		if delay < 2*time.Second || delay > 4*time.Second {
+			t.Fatalf("Expected jittered delay within [2s, 4s], got %v", delay)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/log"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Indexes of the fields in a BaseStation MSG line.
+const (
+	sbsMessageType = iota
+	sbsTransmissionType
+	sbsSessionID
+	sbsAircraftID
+	sbsHexIdent
+	sbsFlightID
+	sbsDateGenerated
+	sbsTimeGenerated
+	sbsDateLogged
+	sbsTimeLogged
+	sbsCallsign
+	sbsAltitude
+	sbsGroundSpeed
+	sbsTrack
+	sbsLatitude
+	sbsLongitude
+	sbsVerticalRate
+	sbsSquawk
+	sbsAlert
+	sbsEmergency
+	sbsSPI
+	sbsIsOnGround
+	sbsFieldCount
+)
+
+// sbsStaleAfter is how long an aircraft that has gone quiet is remembered
+// before its partial state is dropped.
+const sbsStaleAfter = 5 * time.Minute
+
+// SBSSource reads the BaseStation (SBS-1) CSV stream that dump1090 and
+// similar receivers serve on port 30003. Each MSG line only carries some
+// of an aircraft's fields, so the source merges transmission types 1-8
+// into per-aircraft state and emits the merged flight after every line.
+type SBSSource struct {
+	addr    string
+	dialer  net.Dialer
+	backoff *Backoff
+	now     func() time.Time
+
+	mu       sync.Mutex
+	aircraft map[string]*types.Flight
+}
+
+func NewSBSSource(addr string) *SBSSource {
+	return &SBSSource{
+		addr:     addr,
+		dialer:   net.Dialer{Timeout: 10 * time.Second},
+		backoff:  NewBackoff(time.Second, time.Minute),
+		now:      time.Now,
+		aircraft: make(map[string]*types.Flight),
+	}
+}
+
+func (s *SBSSource) Name() string {
+	return "sbs"
+}
+
+// FetchFlights returns the aircraft currently known from the stream.
+func (s *SBSSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flights := make([]types.Flight, 0, len(s.aircraft))
+	for _, flight := range s.aircraft {
+		flights = append(flights, *flight)
+	}
+	return flights, nil
+}
+
+// Run connects to the receiver and emits updates until ctx is cancelled,
+// reconnecting with backoff whenever the connection drops.
+func (s *SBSSource) Run(ctx context.Context, emit func(types.Flight)) error {
+	attempt := 0
+	for {
+		connected, err := s.stream(ctx, emit)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			attempt = 0
+		}
+		attempt++
+
+		delay := s.backoff.Delay(attempt)
+		log.LogError("SBS stream from %s failed, reconnecting in %v: %v", s.addr, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// stream reads from a single connection until it fails. It reports whether
+// the connection was established, so that Run can reset its backoff.
+func (s *SBSSource) stream(ctx context.Context, emit func(types.Flight)) (bool, error) {
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read below when the context is cancelled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	log.LogInfo("Connected to SBS stream at %s", s.addr)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if flight, ok := s.apply(scanner.Text()); ok {
+			emit(flight)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return true, fmt.Errorf("connection closed by receiver")
+}
+
+// apply merges a single line into the aircraft state and returns the
+// updated flight. Lines other than MSG, such as STA or AIR, are ignored.
+func (s *SBSSource) apply(line string) (types.Flight, bool) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) < sbsFieldCount || fields[sbsMessageType] != "MSG" {
+		return types.Flight{}, false
+	}
+
+	icao24 := strings.ToLower(strings.TrimSpace(fields[sbsHexIdent]))
+	if icao24 == "" {
+		return types.Flight{}, false
+	}
+
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flight, ok := s.aircraft[icao24]
+	if !ok {
+		s.prune(now)
+		flight = &types.Flight{
+			ICAO24:          icao24,
+			PositionSource:  types.PositionSourceADSB,
+			OnGroundUnknown: true,
+			SPIUnknown:      true,
+		}
+		s.aircraft[icao24] = flight
+	}
+
+	if callsign := strings.TrimSpace(fields[sbsCallsign]); callsign != "" {
+		flight.Callsign = callsign
+	}
+	if altitude, ok := parseSBSFloat(fields[sbsAltitude]); ok {
+		flight.BaroAltitude = types.Float64(altitude * feetToMetres)
+	}
+	if speed, ok := parseSBSFloat(fields[sbsGroundSpeed]); ok {
+		flight.Velocity = types.Float64(speed * knotsToMetresPerS)
+	}
+	if track, ok := parseSBSFloat(fields[sbsTrack]); ok {
+		flight.TrueTrack = types.Float64(track)
+	}
+	lat, hasLat := parseSBSFloat(fields[sbsLatitude])
+	lon, hasLon := parseSBSFloat(fields[sbsLongitude])
+	if hasLat && hasLon {
+		flight.Latitude = types.Float64(lat)
+		flight.Longitude = types.Float64(lon)
+		flight.TimePosition = types.Time(now)
+	}
+	if rate, ok := parseSBSFloat(fields[sbsVerticalRate]); ok {
+		flight.VerticalRate = types.Float64(rate * feetPerMinToMetres)
+	}
+	if squawk := strings.TrimSpace(fields[sbsSquawk]); squawk != "" {
+		flight.Squawk = squawk
+	}
+	if spi, ok := parseSBSFlag(fields[sbsSPI]); ok {
+		flight.SPI = spi
+		flight.SPIUnknown = false
+	}
+	if onGround, ok := parseSBSFlag(fields[sbsIsOnGround]); ok {
+		flight.OnGround = onGround
+		flight.OnGroundUnknown = false
+	}
+
+	flight.LastContact = now
+	flight.LastUpdated = now
+	return *flight, true
+}
+
+// prune forgets aircraft that have not been heard from recently. It is
+// called with s.mu held.
+func (s *SBSSource) prune(now time.Time) {
+	for icao24, flight := range s.aircraft {
+		if now.Sub(flight.LastContact) > sbsStaleAfter {
+			delete(s.aircraft, icao24)
+		}
+	}
+}
+
+func parseSBSFloat(field string) (float64, bool) {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(field, 64)
+	return v, err == nil
+}
+
+// parseSBSFlag parses the boolean fields, which receivers write as -1 for
+// true and 0 for false.
+func parseSBSFlag(field string) (bool, bool) {
+	switch strings.TrimSpace(field) {
+	case "-1", "1":
+		return true, true
+	case "0":
+		return false, true
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"math"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// replayServer serves a captured SBS log to every connection, then keeps
+// the connection open like a receiver with no more traffic would.
+func replayServer(t *testing.T, path string) net.Listener {
+	t.Helper()
+
+	capture, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read capture: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write(capture)
+				buf := make([]byte, 1)
+				conn.Read(buf)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestSBSSourceMergesMessages(t *testing.T) {
+	listener := replayServer(t, "testdata/sbs.log")
+	defer listener.Close()
+
+	source := NewSBSSource(listener.Addr().String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan types.Flight, 100)
+	go source.Run(ctx, func(flight types.Flight) {
+		updates <- flight
+	})
+
+	// The capture has ten MSG lines; the STA line is ignored.
+	latest := make(map[string]types.Flight)
+	for i := 0; i < 10; i++ {
+		select {
+		case flight := <-updates:
+			latest[flight.ICAO24] = flight
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after %d updates", i)
+		}
+	}
+
+	flight, ok := latest["3c6444"]
+	if !ok {
+		t.Fatal("Expected an update for 3c6444")
+	}
+	if flight.Callsign != "DLH7CD" {
+		t.Errorf("Expected callsign from MSG,1 to be kept, got %q", flight.Callsign)
+	}
+	if flight.Squawk != "1000" {
+		t.Errorf("Expected squawk 1000, got %q", flight.Squawk)
+	}
+	if !flight.HasPosition() || *flight.Latitude != 48.3538 || *flight.Longitude != 11.7861 {
+		t.Errorf("Expected position from MSG,3 to be kept, got %v,%v", flight.Latitude, flight.Longitude)
+	}
+	assertClose(t, "altitude", flight.BaroAltitude, 34475*0.3048)
+	assertClose(t, "velocity", flight.Velocity, 448.0*0.514444)
+	assertClose(t, "vertical rate", flight.VerticalRate, -960*0.00508)
+	assertClose(t, "track", flight.TrueTrack, 271.5)
+
+	ground := latest["4ca2b6"]
+	if !ground.OnGround {
+		t.Error("Expected 4ca2b6 to be on the ground")
+	}
+	if ground.Latitude == nil || *ground.Latitude != 51.4707 {
+		t.Errorf("Expected surface position from MSG,2, got %v", ground.Latitude)
+	}
+
+	flights, _ := source.FetchFlights(ctx)
+	if len(flights) != 2 {
+		t.Errorf("Expected 2 aircraft in the snapshot, got %d", len(flights))
+	}
+}
+
+func TestSBSSourceStopsOnCancel(t *testing.T) {
+	listener := replayServer(t, "testdata/sbs.log")
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewSBSSource(listener.Addr().String()).Run(ctx, func(types.Flight) {})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+func TestSBSSourceIgnoresMalformedLines(t *testing.T) {
+	source := NewSBSSource("")
+	for _, line := range []string{"", "STA,,5,179,400AE7", "MSG,3,111", "MSG,3,1,1,,1,,,,,,,,,,,,,,,,0"} {
+		if _, ok := source.apply(line); ok {
+			t.Errorf("Expected %q to be ignored", line)
+		}
+	}
+}
+
+func TestSBSSourceTracksReportedFlags(t *testing.T) {
+	source := NewSBSSource("")
+
+	// MSG,4 carries no flags, so the ground state and SPI are not known yet.
+	flight, _ := source.apply("MSG,4,111,11111,3C6444,111111,2024/06/22,12:00:00.600,2024/06/22,12:00:00.600,,,447.1,270.0,,,-1024,,,,,")
+	if !flight.OnGroundUnknown || !flight.SPIUnknown {
+		t.Errorf("Expected the flags to be unknown before a message reports them, got %+v", flight)
+	}
+
+	flight, _ = source.apply("MSG,5,111,11111,3C6444,111111,2024/06/22,12:00:01.000,2024/06/22,12:00:01.000,,34475,,,,,,,0,,0,0")
+	if flight.OnGroundUnknown || flight.SPIUnknown || flight.OnGround {
+		t.Errorf("Expected the flags reported by MSG,5, got %+v", flight)
+	}
+}
+
+func assertClose(t *testing.T, name string, got *float64, want float64) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("Expected %s %f, got unknown", name, want)
+		return
+	}
+	if math.Abs(*got-want) > 1e-6 {
+		t.Errorf("Expected %s %f, got %f", name, want, *got)
+	}
+}
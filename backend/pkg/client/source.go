@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Source is a provider of flight states that FlightService polls on every
+// FETCH_INTERVAL tick.
+type Source interface {
+	// Name identifies the source in logs and metrics.
+	Name() string
+	FetchFlights(ctx context.Context) ([]types.Flight, error)
+}
+
+// Streamer is implemented by sources that can hand out flights while the
+// upstream response is still being decoded. Returning an error from emit
+// stops the stream.
+type Streamer interface {
+	StreamFlights(ctx context.Context, emit func(types.Flight) error) error
+}
+
+// LiveSource is implemented by sources that push updates as they arrive,
+// such as a receiver stream, instead of being polled on FETCH_INTERVAL.
+// Run blocks until ctx is cancelled.
+type LiveSource interface {
+	Source
+	Run(ctx context.Context, emit func(types.Flight)) error
+}
+
+// PollAdvisor is implemented by sources that know when they may be polled
+// next, for example because the upstream reports its rate limits.
+type PollAdvisor interface {
+	// NextPoll returns the delay before the next fetch, given the
+	// configured base interval.
+	NextPoll(base time.Duration) time.Duration
+}
+
+// StatusError is returned when an upstream answers with a non-200 status.
+// RetryAfter is set when the upstream said how long to back off for.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	err := &StatusError{StatusCode: resp.StatusCode}
+	for _, header := range []string{"X-Rate-Limit-Retry-After-Seconds", "Retry-After"} {
+		if seconds, convErr := strconv.Atoi(resp.Header.Get(header)); convErr == nil {
+			err.RetryAfter = time.Duration(seconds) * time.Second
+			break
+		}
+	}
+	return err
+}
+
+// NewSources builds the sources listed in FLIGHT_SOURCE, a comma
+// separated list such as "sbs,opensky". The order is kept, so callers can
+// use it as a priority when sources disagree.
+func NewSources(cfg *config.Config) ([]Source, error) {
+	var sources []Source
+	seen := make(map[string]bool)
+	for _, kind := range strings.Split(cfg.FlightSource, ",") {
+		kind = strings.TrimSpace(kind)
+		if seen[kind] {
+			return nil, fmt.Errorf("flight source %q is listed twice", kind)
+		}
+		seen[kind] = true
+
+		source, err := newSource(kind, cfg)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+func newSource(kind string, cfg *config.Config) (Source, error) {
+	switch kind {
+	case "", "opensky":
+		opts := OpenSkyOptions{
+			BaseURL:      cfg.OpenSkyURL,
+			Username:     cfg.OpenSkyUsername,
+			Password:     cfg.OpenSkyPassword,
+			ClientID:     cfg.OpenSkyClientID,
+			ClientSecret: cfg.OpenSkyClientSecret,
+			TokenURL:     cfg.OpenSkyTokenURL,
+			ICAO24:       cfg.OpenSkyICAO24,
+			Extended:     cfg.OpenSkyExtended,
+		}
+		if cfg.OpenSkyBBox != "" {
+			box, err := geo.ParseBBox(cfg.OpenSkyBBox)
+			if err != nil {
+				return nil, fmt.Errorf("invalid OPENSKY_BBOX: %w", err)
+			}
+			opts.BBox = &box
+		}
+		return NewFlightFetcher(opts), nil
+	case "file":
+		if cfg.SourceDir == "" {
+			return nil, fmt.Errorf("FLIGHT_SOURCE_DIR is required for the file source")
+		}
+		return NewFileSource(cfg.SourceDir), nil
+	case "http":
+		if cfg.SourceURL == "" {
+			return nil, fmt.Errorf("FLIGHT_SOURCE_URL is required for the http source")
+		}
+		return NewHTTPSource(cfg.SourceURL), nil
+	case "aircraftjson":
+		if cfg.AircraftJSONURL == "" {
+			return nil, fmt.Errorf("AIRCRAFT_JSON_URL is required for the aircraftjson source")
+		}
+		return NewAircraftJSONSource(cfg.AircraftJSONURL), nil
+	case "sbs":
+		return NewSBSSource(cfg.SBSAddr), nil
+	default:
+		return nil, fmt.Errorf("unknown flight source %q", kind)
+	}
+}
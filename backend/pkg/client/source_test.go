@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func TestNewSources(t *testing.T) {
+	tests := []struct {
+		cfg     config.Config
+		names   []string
+		wantErr bool
+	}{
+		{cfg: config.Config{FlightSource: "opensky", OpenSkyURL: "http://example.com"}, names: []string{"opensky"}},
+		{cfg: config.Config{FlightSource: "file", SourceDir: "/tmp"}, names: []string{"file"}},
+		{cfg: config.Config{FlightSource: "http", SourceURL: "http://example.com"}, names: []string{"http"}},
+		{cfg: config.Config{FlightSource: "sbs, opensky", SBSAddr: "localhost:30003"}, names: []string{"sbs", "opensky"}},
+		{cfg: config.Config{FlightSource: "aircraftjson,http", AircraftJSONURL: "http://receiver/data/aircraft.json", SourceURL: "http://example.com"}, names: []string{"aircraftjson", "http"}},
+		{cfg: config.Config{FlightSource: "aircraftjson", SourceURL: "http://example.com"}, wantErr: true},
+		{cfg: config.Config{FlightSource: "file"}, wantErr: true},
+		{cfg: config.Config{FlightSource: "opensky,opensky"}, wantErr: true},
+		{cfg: config.Config{FlightSource: "carrier-pigeon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		sources, err := NewSources(&tt.cfg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for sources %q", tt.cfg.FlightSource)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for sources %q: %v", tt.cfg.FlightSource, err)
+			continue
+		}
+		if len(sources) != len(tt.names) {
+			t.Errorf("Expected %d sources for %q, got %d", len(tt.names), tt.cfg.FlightSource, len(sources))
+			continue
+		}
+		for i, source := range sources {
+			if source.Name() != tt.names[i] {
+				t.Errorf("Expected source %s, got %s", tt.names[i], source.Name())
+			}
+		}
+	}
+}
+
+func TestFileSourceReplaysSnapshotsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeSnapshot(t, filepath.Join(dir, "001.json"), "aaaaaa")
+	writeSnapshot(t, filepath.Join(dir, "002.json"), "bbbbbb")
+
+	source := NewFileSource(dir)
+
+	for _, want := range []string{"aaaaaa", "bbbbbb", "aaaaaa"} {
+		flights, err := source.FetchFlights(context.Background())
+		if err != nil {
+			t.Fatalf("FetchFlights returned error: %v", err)
+		}
+		if len(flights) != 1 || flights[0].ICAO24 != want {
+			t.Errorf("Expected snapshot with %s, got %+v", want, flights)
+		}
+	}
+}
+
+func TestFileSourceEmptyDirectory(t *testing.T) {
+	if _, err := NewFileSource(t.TempDir()).FetchFlights(context.Background()); err == nil {
+		t.Error("Expected error for a directory without snapshots")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]types.Flight{
+			{ICAO24: "abc123", Latitude: types.Float64(51.5), Longitude: types.Float64(-0.12)},
+		})
+	}))
+	defer server.Close()
+
+	flights, err := NewHTTPSource(server.URL).FetchFlights(context.Background())
+	if err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+
+	if len(flights) != 1 || flights[0].ICAO24 != "abc123" {
+		t.Fatalf("Unexpected flights: %+v", flights)
+	}
+	if !flights[0].HasPosition() {
+		t.Error("Expected position to be decoded")
+	}
+}
+
+func TestHTTPSourceFollowsCursors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "1000" {
+			t.Errorf("Expected the configured query to be kept, got %s", r.URL.RawQuery)
+		}
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Header().Set("X-Next-Cursor", "page2")
+			json.NewEncoder(w).Encode([]types.Flight{{ICAO24: "abc123"}})
+		case "page2":
+			json.NewEncoder(w).Encode([]types.Flight{{ICAO24: "def456"}})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	flights, err := NewHTTPSource(server.URL + "/flights?limit=1000").FetchFlights(context.Background())
+	if err != nil {
+		t.Fatalf("FetchFlights returned error: %v", err)
+	}
+	if len(flights) != 2 || flights[0].ICAO24 != "abc123" || flights[1].ICAO24 != "def456" {
+		t.Errorf("Expected both pages, got %+v", flights)
+	}
+}
+
+func writeSnapshot(t *testing.T, path, icao24 string) {
+	t.Helper()
+	body := `{"time": 1719068400, "states": [["` + icao24 + `", "TEST1   ", "Germany", 1719068399, 1719068399, 11.78, 48.35, 10500.0, false, 230.0, 270.0, 0.0, null, 10668.0, "1000", false, 0]]}`
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+package client
+
+// Unit conversions from the aviation units used by ADS-B receivers to the
+// metres and m/s used by OpenSky and types.Flight.
+const (
+	feetToMetres       = 0.3048
+	knotsToMetresPerS  = 0.514444
+	feetPerMinToMetres = 0.00508
+)
@@ -3,28 +3,103 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	Port         string
 	RedisURL     string
+	Store        string
+	LeaderElection bool
+	LeaderLease  time.Duration
 	KafkaBroker  string
 	KafkaTopic   string
+	KafkaPublish bool
+	KafkaBatchSize int
+	KafkaBatchTimeout time.Duration
+	KafkaFormat  string
+	KafkaDeadLetterTopic string
+	SchemaRegistryURL string
 	FetchInterval time.Duration
+	FetchMaxBackoff time.Duration
+	BreakerThreshold int
+	BreakerOpenTimeout time.Duration
+	FlightTTL      time.Duration
+	EvictionInterval time.Duration
+	TrackLength    int
+	SnapshotPath   string
+	SnapshotInterval time.Duration
+	BroadcastInterval time.Duration
 	MaxConnections int
+	MaxConnectionsPerIP int
+	TrustedProxies []string
 	RateLimitPerIP int
+	FlightSource   string
+	OpenSkyURL     string
+	SourceDir      string
+	SourceURL      string
+	AircraftJSONURL string
+	SBSAddr        string
+
+	// OpenSky credentials, either basic auth or OAuth client credentials.
+	OpenSkyUsername     string
+	OpenSkyPassword     string
+	OpenSkyClientID     string
+	OpenSkyClientSecret string
+	OpenSkyTokenURL     string
+
+	// OpenSky query parameters.
+	OpenSkyBBox     string
+	OpenSkyICAO24   []string
+	OpenSkyExtended bool
 }
 
 func Load() *Config {
 	return &Config{
 		Port:           getEnv("PORT", "8080"),
 		RedisURL:       getEnv("REDIS_URL", "localhost:6379"),
+		Store:          getEnv("STORE", "memory"),
+		LeaderElection: getBool("LEADER_ELECTION", false),
+		LeaderLease:    getDuration("LEADER_LEASE", "15s"),
 		KafkaBroker:    getEnv("KAFKA_BROKER", "localhost:32092"),
 		KafkaTopic:     getEnv("KAFKA_TOPIC", "flight-events"),
+		KafkaPublish:   getBool("KAFKA_PUBLISH", false),
+		KafkaBatchSize: getInt("KAFKA_BATCH_SIZE", 100),
+		KafkaBatchTimeout: getDuration("KAFKA_BATCH_TIMEOUT", "200ms"),
+		KafkaFormat:    getEnv("KAFKA_FORMAT", "json"),
+		KafkaDeadLetterTopic: getEnv("KAFKA_DEAD_LETTER_TOPIC", "flight-events-dlq"),
+		SchemaRegistryURL: getEnv("SCHEMA_REGISTRY_URL", "http://localhost:8081"),
 		FetchInterval:  getDuration("FETCH_INTERVAL", "15s"),
+		FetchMaxBackoff: getDuration("FETCH_MAX_BACKOFF", "5m"),
+		BreakerThreshold: getInt("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerOpenTimeout: getDuration("BREAKER_OPEN_TIMEOUT", "1m"),
+		FlightTTL:      getDuration("FLIGHT_TTL", "5m"),
+		EvictionInterval: getDuration("EVICTION_INTERVAL", "30s"),
+		TrackLength:    getInt("TRACK_LENGTH", 240),
+		SnapshotPath:   getEnv("SNAPSHOT_PATH", "/tmp/flight-data-snapshot.json.gz"),
+		SnapshotInterval: getDuration("SNAPSHOT_INTERVAL", "30s"),
+		BroadcastInterval: getDuration("BROADCAST_INTERVAL", "500ms"),
 		MaxConnections: getInt("MAX_CONNECTIONS", 1000),
+		MaxConnectionsPerIP: getInt("MAX_CONNECTIONS_PER_IP", 10),
+		TrustedProxies: getList("TRUSTED_PROXIES"),
 		RateLimitPerIP: getInt("RATE_LIMIT_PER_IP", 5),
+		FlightSource:   getEnv("FLIGHT_SOURCE", "opensky"),
+		OpenSkyURL:     getEnv("OPEN_SKY_API_URL", "https://opensky-network.org/api/states/all"),
+		SourceDir:      getEnv("FLIGHT_SOURCE_DIR", ""),
+		SourceURL:      getEnv("FLIGHT_SOURCE_URL", ""),
+		AircraftJSONURL: getEnv("AIRCRAFT_JSON_URL", ""),
+		SBSAddr:        getEnv("SBS_ADDR", "localhost:30003"),
+
+		OpenSkyUsername:     getEnv("OPENSKY_USERNAME", ""),
+		OpenSkyPassword:     getEnv("OPENSKY_PASSWORD", ""),
+		OpenSkyClientID:     getEnv("OPENSKY_CLIENT_ID", ""),
+		OpenSkyClientSecret: getEnv("OPENSKY_CLIENT_SECRET", ""),
+		OpenSkyTokenURL:     getEnv("OPENSKY_TOKEN_URL", "https://auth.opensky-network.org/auth/realms/opensky-network/protocol/openid-connect/token"),
+
+		OpenSkyBBox:     getEnv("OPENSKY_BBOX", ""),
+		OpenSkyICAO24:   getList("OPENSKY_ICAO24"),
+		OpenSkyExtended: getBool("OPENSKY_EXTENDED", false),
 	}
 }
 
@@ -52,4 +127,24 @@ func getDuration(key, defaultValue string) time.Duration {
 	}
 	d, _ := time.ParseDuration(defaultValue)
 	return d
-}
\ No newline at end of file
+}
+
+func getBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// getList splits a comma separated variable, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/log"
+	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers of dead-letter messages.
+const (
+	HeaderValidationError  = "validation-error"
+	HeaderValidationFields = "validation-fields"
+)
+
+// Rejected is a flight that failed validation, with the reasons.
+type Rejected struct {
+	Flight types.Flight
+	Err    *schema.RecordError
+}
+
+// DeadLetter receives flights that failed validation.
+type DeadLetter interface {
+	Reject(ctx context.Context, rejected []Rejected) error
+	Close() error
+}
+
+// KafkaDeadLetter writes rejected flights to a Kafka topic as JSON keyed
+// by ICAO24. The reason is carried in the validation-error header as text
+// and in the validation-fields header as a JSON array of field errors.
+type KafkaDeadLetter struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaDeadLetter(brokers, topic string) *KafkaDeadLetter {
+	return &KafkaDeadLetter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+		},
+	}
+}
+
+func (d *KafkaDeadLetter) Reject(ctx context.Context, rejected []Rejected) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	return d.writer.WriteMessages(ctx, deadLetterMessages(rejected)...)
+}
+
+func (d *KafkaDeadLetter) Close() error {
+	return d.writer.Close()
+}
+
+func deadLetterMessages(rejected []Rejected) []kafka.Message {
+	now := time.Now()
+	messages := make([]kafka.Message, 0, len(rejected))
+	for _, r := range rejected {
+		value, _ := json.Marshal(r.Flight)
+		fields, _ := json.Marshal(r.Err.Fields)
+		messages = append(messages, kafka.Message{
+			Key:   []byte(r.Flight.ICAO24),
+			Value: value,
+			Time:  now,
+			Headers: []kafka.Header{
+				{Key: HeaderValidationError, Value: []byte(r.Err.Error())},
+				{Key: HeaderValidationFields, Value: fields},
+			},
+		})
+	}
+	return messages
+}
+
+// validatingPublisher checks updated flights before passing them on.
+type validatingPublisher struct {
+	next       Publisher
+	validator  *schema.Validator
+	deadLetter DeadLetter
+}
+
+// Validating returns a Publisher that passes events on to next, except
+// updates whose flight fails validator, which are sent to deadLetter
+// instead. A nil validator only applies schema.ValidateFlight and a nil
+// deadLetter drops invalid flights.
+func Validating(next Publisher, validator *schema.Validator, deadLetter DeadLetter) Publisher {
+	return &validatingPublisher{next: next, validator: validator, deadLetter: deadLetter}
+}
+
+func (p *validatingPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	valid := make([]types.FlightEvent, 0, len(events))
+	var rejected []Rejected
+	for i, event := range events {
+		if event.Type == types.FlightUpdated && event.Flight != nil {
+			if err := p.validator.Validate(*event.Flight); err != nil {
+				err.Index = i
+				rejected = append(rejected, Rejected{Flight: *event.Flight, Err: err})
+				for _, field := range err.Fields {
+					observability.FlightRecordsInvalid.WithLabelValues(field.Field).Inc()
+				}
+				continue
+			}
+		}
+		valid = append(valid, event)
+	}
+
+	if len(rejected) > 0 {
+		log.LogWarn("Rejected %d invalid flights, first: %v", len(rejected), rejected[0].Err)
+		if p.deadLetter != nil {
+			if err := p.deadLetter.Reject(ctx, rejected); err != nil {
+				log.LogError("Failed to write %d flights to the dead-letter topic: %v", len(rejected), err)
+			}
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	return p.next.Publish(ctx, valid)
+}
+
+func (p *validatingPublisher) Close() error {
+	err := p.next.Close()
+	if p.deadLetter != nil {
+		if dlErr := p.deadLetter.Close(); err == nil {
+			err = dlErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+type recordingPublisher struct {
+	events []types.FlightEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	p.events = append(p.events, events...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+type recordingDeadLetter struct {
+	rejected []Rejected
+}
+
+func (d *recordingDeadLetter) Reject(ctx context.Context, rejected []Rejected) error {
+	d.rejected = append(d.rejected, rejected...)
+	return nil
+}
+
+func (d *recordingDeadLetter) Close() error {
+	return nil
+}
+
+func TestValidatingPublisher(t *testing.T) {
+	next := &recordingPublisher{}
+	deadLetter := &recordingDeadLetter{}
+	publisher := Validating(next, nil, deadLetter)
+
+	valid := types.Flight{ICAO24: "3c6444", Latitude: types.Float64(48.35), Longitude: types.Float64(11.78), LastContact: time.Now()}
+	invalid := types.Flight{ICAO24: "3c6445", Latitude: types.Float64(148.35), Longitude: types.Float64(11.78), LastContact: time.Now()}
+	err := publisher.Publish(context.Background(), []types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: valid.ICAO24, Flight: &valid},
+		{Type: types.FlightUpdated, ICAO24: invalid.ICAO24, Flight: &invalid},
+		{Type: types.FlightRemoved, ICAO24: "4ca2b6", Reason: "expired"},
+	})
+	if err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	if len(next.events) != 2 || next.events[0].ICAO24 != "3c6444" || next.events[1].ICAO24 != "4ca2b6" {
+		t.Errorf("Expected the valid update and the removal to pass, got %+v", next.events)
+	}
+	if len(deadLetter.rejected) != 1 || deadLetter.rejected[0].Flight.ICAO24 != "3c6445" {
+		t.Fatalf("Expected the invalid update to be dead-lettered, got %+v", deadLetter.rejected)
+	}
+	if fields := deadLetter.rejected[0].Err.Fields; len(fields) != 1 || fields[0].Field != "latitude" {
+		t.Errorf("Expected a latitude error, got %v", fields)
+	}
+}
+
+// flightValidator validates against schemas/flight-avro.avsc served as the
+// latest version of schema.FlightSubject.
+func flightValidator(t *testing.T) *schema.Validator {
+	avsc, err := os.ReadFile("../../schemas/flight-avro.avsc")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	response, _ := json.Marshal(map[string]interface{}{
+		"subject": schema.FlightSubject,
+		"version": 1,
+		"id":      1,
+		"schema":  string(avsc),
+	})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(response)
+	}))
+	t.Cleanup(registry.Close)
+
+	validator, err := schema.NewFlightValidator(&config.Config{SchemaRegistryURL: registry.URL})
+	if err != nil {
+		t.Fatalf("NewFlightValidator returned error: %v", err)
+	}
+	return validator
+}
+
+func TestValidatingPublisherDeadLettersRecordsMissingRequiredFields(t *testing.T) {
+	next := &recordingPublisher{}
+	deadLetter := &recordingDeadLetter{}
+	publisher := Validating(next, flightValidator(t), deadLetter)
+
+	valid := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", OriginCountry: "Germany", LastContact: time.Now()}
+	noCallsign, noCountry := valid, valid
+	noCallsign.ICAO24, noCallsign.Callsign = "3c6445", ""
+	noCountry.ICAO24, noCountry.OriginCountry = "3c6446", ""
+	err := publisher.Publish(context.Background(), []types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: valid.ICAO24, Flight: &valid},
+		{Type: types.FlightUpdated, ICAO24: noCallsign.ICAO24, Flight: &noCallsign},
+		{Type: types.FlightUpdated, ICAO24: noCountry.ICAO24, Flight: &noCountry},
+	})
+	if err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	if len(next.events) != 1 || next.events[0].ICAO24 != "3c6444" {
+		t.Errorf("Expected only the complete flight to pass, got %+v", next.events)
+	}
+	if len(deadLetter.rejected) != 2 {
+		t.Fatalf("Expected two flights to be dead-lettered, got %+v", deadLetter.rejected)
+	}
+	for i, field := range []string{"callsign", "originCountry"} {
+		fields := deadLetter.rejected[i].Err.Fields
+		if len(fields) != 1 || fields[0].Field != field || fields[0].Reason != "is required by the schema" {
+			t.Errorf("Expected %s to be required, got %v", field, fields)
+		}
+	}
+}
+
+func TestDeadLetterMessages(t *testing.T) {
+	flight := types.Flight{ICAO24: "3c644z"}
+	messages := deadLetterMessages([]Rejected{{Flight: flight, Err: schema.ValidateFlight(flight)}})
+
+	if len(messages) != 1 || string(messages[0].Key) != "3c644z" {
+		t.Fatalf("Expected one message keyed by ICAO24, got %+v", messages)
+	}
+	headers := map[string]string{}
+	for _, header := range messages[0].Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	if !strings.Contains(headers[HeaderValidationError], "icao24: must be 6 hexadecimal digits") {
+		t.Errorf("Expected the reason in the headers, got %q", headers[HeaderValidationError])
+	}
+
+	var fields []schema.FieldError
+	if err := json.Unmarshal([]byte(headers[HeaderValidationFields]), &fields); err != nil || len(fields) != 2 {
+		t.Errorf("Expected icao24 and last_contact field errors, got %s", headers[HeaderValidationFields])
+	}
+}
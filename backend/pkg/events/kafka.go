@@ -0,0 +1,160 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/log"
+	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher writes flight events to a Kafka topic keyed by ICAO24.
+// Updates carry the flight encoded by codec and removals are written as tombstones
+// (a nil value), so a compacted topic only retains live aircraft.
+//
+// Writes are asynchronous: events are buffered and sent in batches of up to
+// batchSize messages, or whatever has accumulated after batchTimeout.
+// Delivery results are recorded as metrics and failures are logged, since
+// Publish returns before the batch is acknowledged.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+	codec  schema.Codec
+}
+
+func NewKafkaPublisher(brokers, topic string, codec schema.Codec, batchSize int, batchTimeout time.Duration) *KafkaPublisher {
+	return &KafkaPublisher{
+		codec: codec,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+			Compression:  kafka.Snappy,
+			BatchSize:    batchSize,
+			BatchTimeout: batchTimeout,
+			Async:        true,
+			Completion:   delivered,
+		},
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	messages, err := p.toMessages(events)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, messages...)
+}
+
+// Close flushes the buffered events and closes the writer.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// delivered records the outcome of writing a batch of messages.
+func delivered(messages []kafka.Message, err error) {
+	observability.FlightEventBatchSize.Observe(float64(len(messages)))
+	if err != nil {
+		observability.FlightEventsPublished.WithLabelValues("failed").Add(float64(len(messages)))
+		log.LogError("Failed to deliver %d flight events to Kafka: %v", len(messages), err)
+		return
+	}
+
+	observability.FlightEventsPublished.WithLabelValues("delivered").Add(float64(len(messages)))
+	now := time.Now()
+	for _, message := range messages {
+		observability.FlightEventDeliveryLatency.Observe(now.Sub(message.Time).Seconds())
+	}
+}
+
+func (p *KafkaPublisher) toMessages(events []types.FlightEvent) ([]kafka.Message, error) {
+	now := time.Now()
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		message := kafka.Message{
+			Key:  []byte(event.ICAO24),
+			Time: now,
+		}
+		if event.Type == types.FlightUpdated && event.Flight != nil {
+			data, err := p.codec.Encode(*event.Flight)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode flight %s: %w", event.ICAO24, err)
+			}
+			message.Value = data
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// KafkaSubscriber reads the flight events written by KafkaPublisher.
+// Every subscriber joins its own consumer group, so that each replica of a
+// consumer sees every event, and starts from the newest offset.
+type KafkaSubscriber struct {
+	reader *kafka.Reader
+	codec  schema.Codec
+}
+
+func NewKafkaSubscriber(brokers, topic, group string, codec schema.Codec) *KafkaSubscriber {
+	return &KafkaSubscriber{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     strings.Split(brokers, ","),
+			Topic:       topic,
+			GroupID:     group,
+			StartOffset: kafka.LastOffset,
+			MaxWait:     500 * time.Millisecond,
+		}),
+		codec: codec,
+	}
+}
+
+// Run calls handle with every event read until ctx is cancelled.
+// Messages that cannot be decoded are logged and skipped.
+func (s *KafkaSubscriber) Run(ctx context.Context, handle func([]types.FlightEvent)) error {
+	for {
+		message, err := s.reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		event, err := s.fromMessage(message)
+		if err != nil {
+			log.LogError("Failed to decode flight event at offset %d: %v", message.Offset, err)
+			continue
+		}
+		handle([]types.FlightEvent{event})
+	}
+}
+
+func (s *KafkaSubscriber) Close() error {
+	return s.reader.Close()
+}
+
+// fromMessage is the inverse of toMessages: tombstones are removals and
+// anything else is an update.
+func (s *KafkaSubscriber) fromMessage(message kafka.Message) (types.FlightEvent, error) {
+	icao24 := string(message.Key)
+	if len(message.Value) == 0 {
+		return types.FlightEvent{Type: types.FlightRemoved, ICAO24: icao24}, nil
+	}
+
+	flight, err := s.codec.Decode(message.Value)
+	if err != nil {
+		return types.FlightEvent{}, err
+	}
+	if icao24 == "" {
+		icao24 = flight.ICAO24
+	}
+	return types.FlightEvent{Type: types.FlightUpdated, ICAO24: icao24, Flight: &flight}, nil
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestToMessages(t *testing.T) {
+	flight := types.Flight{ICAO24: "3c6444", Callsign: "DLH7CD"}
+	publisher := &KafkaPublisher{codec: schema.JSONCodec{}}
+	messages, err := publisher.toMessages([]types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &flight},
+		{Type: types.FlightRemoved, ICAO24: "4ca2b6", Reason: "expired"},
+	})
+	if err != nil {
+		t.Fatalf("toMessages returned error: %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+
+	if string(messages[0].Key) != "3c6444" {
+		t.Errorf("Expected update keyed by ICAO24, got %s", messages[0].Key)
+	}
+	var decoded types.Flight
+	if err := json.Unmarshal(messages[0].Value, &decoded); err != nil || decoded.Callsign != "DLH7CD" {
+		t.Errorf("Expected update to carry the flight, got %s", messages[0].Value)
+	}
+
+	if string(messages[1].Key) != "4ca2b6" || messages[1].Value != nil {
+		t.Errorf("Expected removal to be a tombstone, got %q=%q", messages[1].Key, messages[1].Value)
+	}
+}
+
+func TestDeliveredRecordsMetrics(t *testing.T) {
+	delivered0 := testutil.ToFloat64(observability.FlightEventsPublished.WithLabelValues("delivered"))
+	failed0 := testutil.ToFloat64(observability.FlightEventsPublished.WithLabelValues("failed"))
+
+	sent := time.Now()
+	messages := []kafka.Message{{Key: []byte("3c6444"), Time: sent}, {Key: []byte("4ca2b6"), Time: sent}}
+	delivered(messages, nil)
+	delivered(messages[:1], errors.New("leader not available"))
+
+	if got := testutil.ToFloat64(observability.FlightEventsPublished.WithLabelValues("delivered")) - delivered0; got != 2 {
+		t.Errorf("Expected 2 delivered events, got %v", got)
+	}
+	if got := testutil.ToFloat64(observability.FlightEventsPublished.WithLabelValues("failed")) - failed0; got != 1 {
+		t.Errorf("Expected 1 failed event, got %v", got)
+	}
+}
+
+func TestFromMessage(t *testing.T) {
+	publisher := &KafkaPublisher{codec: schema.JSONCodec{}}
+	subscriber := &KafkaSubscriber{codec: schema.JSONCodec{}}
+
+	flight := types.Flight{ICAO24: "3c6444", Callsign: "DLH7CD"}
+	messages, _ := publisher.toMessages([]types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &flight},
+		{Type: types.FlightRemoved, ICAO24: "4ca2b6", Reason: "expired"},
+	})
+
+	update, err := subscriber.fromMessage(messages[0])
+	if err != nil {
+		t.Fatalf("fromMessage returned error: %v", err)
+	}
+	if update.Type != types.FlightUpdated || update.ICAO24 != "3c6444" || update.Flight == nil || update.Flight.Callsign != "DLH7CD" {
+		t.Errorf("Expected the update to round trip, got %+v", update)
+	}
+
+	removal, err := subscriber.fromMessage(messages[1])
+	if err != nil || removal.Type != types.FlightRemoved || removal.ICAO24 != "4ca2b6" || removal.Flight != nil {
+		t.Errorf("Expected a tombstone to be a removal, got %+v (%v)", removal, err)
+	}
+
+	if _, err := subscriber.fromMessage(kafka.Message{Key: []byte("3c6444"), Value: []byte("{")}); err == nil {
+		t.Error("Expected an error for a malformed value")
+	}
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Publisher delivers flight events to downstream consumers such as Kafka.
+type Publisher interface {
+	Publish(ctx context.Context, events []types.FlightEvent) error
+	Close() error
+}
+
+// NopPublisher discards every event. It is used when publishing is
+// disabled.
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	return nil
+}
+
+func (NopPublisher) Close() error {
+	return nil
+}
+
+// multiPublisher delivers every event to each of its publishers.
+type multiPublisher []Publisher
+
+// Multi returns a Publisher that publishes to each of publishers in turn,
+// returning the first error after trying all of them.
+func Multi(publishers ...Publisher) Publisher {
+	return multiPublisher(publishers)
+}
+
+func (m multiPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	var first error
+	for _, p := range m {
+		if err := p.Publish(ctx, events); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m multiPublisher) Close() error {
+	var first error
+	for _, p := range m {
+		if err := p.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/real-time-dashboard/backend/pkg/log"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPublisher broadcasts each batch of flight events as a JSON array on
+// a Redis pub/sub channel, for replicas that do not fetch themselves.
+type RedisPublisher struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisPublisher(client *redis.Client, channel string) *RedisPublisher {
+	return &RedisPublisher{client: client, channel: channel}
+}
+
+func (p *RedisPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, p.channel, data).Err()
+}
+
+// Close does nothing; the client is owned by the caller.
+func (p *RedisPublisher) Close() error {
+	return nil
+}
+
+// Subscribe calls handle with every batch published on channel until ctx
+// is cancelled. Malformed messages are logged and skipped.
+func Subscribe(ctx context.Context, client *redis.Client, channel string, handle func([]types.FlightEvent)) error {
+	sub := client.Subscribe(ctx, channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var events []types.FlightEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &events); err != nil {
+				log.LogError("Failed to decode flight events from %s: %v", channel, err)
+				continue
+			}
+			handle(events)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisPublishSubscribe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan []types.FlightEvent, 1)
+	go Subscribe(ctx, client, "flights:updates", func(events []types.FlightEvent) {
+		received <- events
+	})
+
+	// Wait for the subscription before publishing, as pub/sub does not
+	// retain messages.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mr.PubSubChannels("flights:updates")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the subscription")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	flight := types.Flight{ICAO24: "3c6444", Callsign: "DLH7CD"}
+	publisher := Multi(NopPublisher{}, NewRedisPublisher(client, "flights:updates"))
+	err := publisher.Publish(ctx, []types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &flight},
+		{Type: types.FlightRemoved, ICAO24: "4ca2b6", Reason: "expired"},
+	})
+	if err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	select {
+	case events := <-received:
+		if len(events) != 2 || events[0].Flight.Callsign != "DLH7CD" || events[1].Type != types.FlightRemoved {
+			t.Errorf("Expected the published batch, got %+v", events)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the published events")
+	}
+}
@@ -0,0 +1,281 @@
+package fusion
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Default thresholds for treating two position reports as conflicting.
+const (
+	DefaultConflictDistanceKm = 10.0
+	DefaultConflictWindow     = 5 * time.Second
+)
+
+// field describes one independently merged part of a Flight. Fields that
+// only make sense together, such as latitude and longitude, form a single
+// field.
+type field struct {
+	name  string
+	known func(f types.Flight) bool
+	copy  func(dst *types.Flight, src types.Flight)
+	// at returns the time the value was observed.
+	at func(f types.Flight) time.Time
+}
+
+func lastContact(f types.Flight) time.Time {
+	return f.LastContact
+}
+
+func positionTime(f types.Flight) time.Time {
+	if f.TimePosition != nil {
+		return *f.TimePosition
+	}
+	return f.LastContact
+}
+
+var fields = []field{
+	{
+		name:  "callsign",
+		known: func(f types.Flight) bool { return f.Callsign != "" },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.Callsign = src.Callsign },
+		at:    lastContact,
+	},
+	{
+		name:  "origin_country",
+		known: func(f types.Flight) bool { return f.OriginCountry != "" },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.OriginCountry = src.OriginCountry },
+		at:    lastContact,
+	},
+	{
+		name:  "position",
+		known: types.Flight.HasPosition,
+		copy: func(dst *types.Flight, src types.Flight) {
+			dst.Latitude = src.Latitude
+			dst.Longitude = src.Longitude
+			dst.TimePosition = src.TimePosition
+			dst.PositionSource = src.PositionSource
+		},
+		at: positionTime,
+	},
+	{
+		name:  "baro_altitude",
+		known: func(f types.Flight) bool { return f.BaroAltitude != nil },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.BaroAltitude = src.BaroAltitude },
+		at:    lastContact,
+	},
+	{
+		name:  "geo_altitude",
+		known: func(f types.Flight) bool { return f.GeoAltitude != nil },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.GeoAltitude = src.GeoAltitude },
+		at:    lastContact,
+	},
+	{
+		name:  "on_ground",
+		known: func(f types.Flight) bool { return !f.OnGroundUnknown },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.OnGround = src.OnGround },
+		at:    lastContact,
+	},
+	{
+		name:  "velocity",
+		known: func(f types.Flight) bool { return f.Velocity != nil },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.Velocity = src.Velocity },
+		at:    lastContact,
+	},
+	{
+		name:  "true_track",
+		known: func(f types.Flight) bool { return f.TrueTrack != nil },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.TrueTrack = src.TrueTrack },
+		at:    lastContact,
+	},
+	{
+		name:  "vertical_rate",
+		known: func(f types.Flight) bool { return f.VerticalRate != nil },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.VerticalRate = src.VerticalRate },
+		at:    lastContact,
+	},
+	{
+		name:  "sensors",
+		known: func(f types.Flight) bool { return len(f.Sensors) > 0 },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.Sensors = src.Sensors },
+		at:    lastContact,
+	},
+	{
+		name:  "squawk",
+		known: func(f types.Flight) bool { return f.Squawk != "" },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.Squawk = src.Squawk },
+		at:    lastContact,
+	},
+	{
+		name:  "spi",
+		known: func(f types.Flight) bool { return !f.SPIUnknown },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.SPI = src.SPI },
+		at:    lastContact,
+	},
+	{
+		name:  "category",
+		known: func(f types.Flight) bool { return f.Category != 0 },
+		copy:  func(dst *types.Flight, src types.Flight) { dst.Category = src.Category },
+		at:    lastContact,
+	},
+}
+
+// stamp records where and when the current value of a field came from.
+type stamp struct {
+	source string
+	at     time.Time
+}
+
+// Merger fuses updates for the same aircraft from several sources. Each
+// field keeps the freshest known value, so a receiver reporting position
+// every second and OpenSky adding the origin country every 15 seconds
+// combine into one record instead of overwriting each other.
+//
+// Two sources reporting positions more than ConflictDistanceKm apart within
+// ConflictWindow of each other are treated as disagreeing, and the position
+// from the source listed first in the priority order wins regardless of
+// which one is fresher.
+type Merger struct {
+	ConflictDistanceKm float64
+	ConflictWindow     time.Duration
+
+	priority map[string]int
+
+	mu     sync.Mutex
+	stamps map[string]map[string]stamp
+}
+
+// NewMerger creates a Merger. priority lists source names from most to
+// least trusted; unlisted sources rank last.
+func NewMerger(priority []string) *Merger {
+	ranks := make(map[string]int, len(priority))
+	for i, name := range priority {
+		ranks[name] = i
+	}
+	return &Merger{
+		ConflictDistanceKm: DefaultConflictDistanceKm,
+		ConflictWindow:     DefaultConflictWindow,
+		priority:           ranks,
+		stamps:             make(map[string]map[string]stamp),
+	}
+}
+
+// Merge folds update, received from source, into current and returns the
+// merged record. exists is false when the aircraft is not yet tracked.
+func (m *Merger) Merge(current types.Flight, exists bool, source string, update types.Flight) types.Flight {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !exists {
+		current = types.Flight{ICAO24: update.ICAO24}
+		delete(m.stamps, update.ICAO24)
+	}
+	stamps, ok := m.stamps[update.ICAO24]
+	if !ok {
+		// A record tracked before the merger saw it, e.g. one restored
+		// from a snapshot, keeps its values until fresher ones arrive.
+		stamps = seedStamps(current)
+		m.stamps[update.ICAO24] = stamps
+	}
+
+	merged := current
+	for _, f := range fields {
+		if !f.known(update) {
+			continue
+		}
+
+		next := stamp{source: source, at: f.at(update)}
+		prev, known := stamps[f.name]
+		if known && !m.prefer(f.name, current, prev, update, next) {
+			continue
+		}
+
+		f.copy(&merged, update)
+		stamps[f.name] = next
+	}
+
+	if update.LastContact.After(merged.LastContact) {
+		merged.LastContact = update.LastContact
+	}
+	if update.LastUpdated.After(merged.LastUpdated) {
+		merged.LastUpdated = update.LastUpdated
+	}
+	merged.Sources, merged.FieldSources = attribution(stamps)
+	return merged
+}
+
+// prefer reports whether the value in update should replace the current
+// value of the named field.
+func (m *Merger) prefer(name string, current types.Flight, prev stamp, update types.Flight, next stamp) bool {
+	if name == "position" && prev.source != next.source && m.conflicting(current, prev, update, next) {
+		observability.FusionPositionConflicts.Inc()
+		return m.rank(next.source) < m.rank(prev.source)
+	}
+
+	if next.at.Equal(prev.at) {
+		return prev.source == next.source || m.rank(next.source) < m.rank(prev.source)
+	}
+	return next.at.After(prev.at)
+}
+
+// conflicting reports whether two positions observed at about the same
+// time are too far apart to both be right.
+func (m *Merger) conflicting(current types.Flight, prev stamp, update types.Flight, next stamp) bool {
+	gap := next.at.Sub(prev.at)
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap > m.ConflictWindow {
+		return false
+	}
+	distance := geo.Distance(*current.Latitude, *current.Longitude, *update.Latitude, *update.Longitude)
+	return distance > m.ConflictDistanceKm
+}
+
+func (m *Merger) rank(source string) int {
+	if rank, ok := m.priority[source]; ok {
+		return rank
+	}
+	return len(m.priority)
+}
+
+// Forget drops the field history of an aircraft that is no longer tracked.
+func (m *Merger) Forget(icao24 string) {
+	m.mu.Lock()
+	delete(m.stamps, icao24)
+	m.mu.Unlock()
+}
+
+func seedStamps(current types.Flight) map[string]stamp {
+	stamps := make(map[string]stamp)
+	if current.LastContact.IsZero() {
+		return stamps
+	}
+	for _, f := range fields {
+		if f.known(current) {
+			stamps[f.name] = stamp{source: current.FieldSources[f.name], at: f.at(current)}
+		}
+	}
+	return stamps
+}
+
+func attribution(stamps map[string]stamp) ([]string, map[string]string) {
+	fieldSources := make(map[string]string, len(stamps))
+	seen := make(map[string]bool)
+	var sources []string
+	for name, s := range stamps {
+		if s.source == "" {
+			continue
+		}
+		fieldSources[name] = s.source
+		if s.source != "" && !seen[s.source] {
+			seen[s.source] = true
+			sources = append(sources, s.source)
+		}
+	}
+	sort.Strings(sources)
+	return sources, fieldSources
+}
@@ -0,0 +1,193 @@
+package fusion
+
+import (
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+var base = time.Date(2024, 6, 22, 12, 0, 0, 0, time.UTC)
+
+func at(seconds int) time.Time {
+	return base.Add(time.Duration(seconds) * time.Second)
+}
+
+func TestMergeKeepsFreshestFieldPerSource(t *testing.T) {
+	m := NewMerger([]string{"sbs", "opensky"})
+
+	opensky := types.Flight{
+		ICAO24:        "3c6444",
+		Callsign:      "DLH7CD",
+		OriginCountry: "Germany",
+		Latitude:      types.Float64(48.35),
+		Longitude:     types.Float64(11.78),
+		TimePosition:  types.Time(at(0)),
+		BaroAltitude:  types.Float64(10500),
+		Velocity:      types.Float64(230),
+		LastContact:   at(0),
+	}
+	merged := m.Merge(types.Flight{}, false, "opensky", opensky)
+
+	// The receiver has a newer position and altitude but no country.
+	sbs := types.Flight{
+		ICAO24:       "3c6444",
+		Latitude:     types.Float64(48.36),
+		Longitude:    types.Float64(11.76),
+		TimePosition: types.Time(at(3)),
+		BaroAltitude: types.Float64(10520),
+		LastContact:  at(3),
+	}
+	merged = m.Merge(merged, true, "sbs", sbs)
+
+	if *merged.Latitude != 48.36 || *merged.BaroAltitude != 10520 {
+		t.Errorf("Expected the fresher receiver position and altitude, got %v %v", *merged.Latitude, *merged.BaroAltitude)
+	}
+	if merged.OriginCountry != "Germany" || *merged.Velocity != 230 {
+		t.Error("Expected fields only OpenSky knows to be kept")
+	}
+	if !merged.LastContact.Equal(at(3)) {
+		t.Errorf("Expected last contact to be the latest, got %v", merged.LastContact)
+	}
+
+	if merged.FieldSources["position"] != "sbs" || merged.FieldSources["origin_country"] != "opensky" {
+		t.Errorf("Unexpected field attribution: %v", merged.FieldSources)
+	}
+	if len(merged.Sources) != 2 || merged.Sources[0] != "opensky" || merged.Sources[1] != "sbs" {
+		t.Errorf("Expected both sources to be listed, got %v", merged.Sources)
+	}
+
+	// A late OpenSky update with an older position must not move the aircraft back.
+	stale := opensky
+	stale.LastContact = at(2)
+	stale.TimePosition = types.Time(at(1))
+	stale.Latitude = types.Float64(48.30)
+	merged = m.Merge(merged, true, "opensky", stale)
+
+	if *merged.Latitude != 48.36 {
+		t.Errorf("Expected older position to be ignored, got %v", *merged.Latitude)
+	}
+}
+
+func TestMergeKeepsFlagsMissingFromPartialUpdate(t *testing.T) {
+	m := NewMerger([]string{"sbs", "opensky"})
+
+	merged := m.Merge(types.Flight{}, false, "opensky", types.Flight{
+		ICAO24:      "4ca2b6",
+		OnGround:    true,
+		SPI:         true,
+		LastContact: at(0),
+	})
+
+	// A fresher SBS message without flags, such as MSG,4, only knows the
+	// velocity.
+	merged = m.Merge(merged, true, "sbs", types.Flight{
+		ICAO24:          "4ca2b6",
+		Velocity:        types.Float64(12),
+		LastContact:     at(2),
+		OnGroundUnknown: true,
+		SPIUnknown:      true,
+	})
+	if !merged.OnGround || !merged.SPI {
+		t.Errorf("Expected the flags reported by OpenSky to be kept, got on_ground %v spi %v", merged.OnGround, merged.SPI)
+	}
+	if merged.FieldSources["on_ground"] != "opensky" || merged.FieldSources["velocity"] != "sbs" {
+		t.Errorf("Unexpected field attribution: %v", merged.FieldSources)
+	}
+
+	// Once SBS reports the ground state, its fresher value wins.
+	merged = m.Merge(merged, true, "sbs", types.Flight{
+		ICAO24:      "4ca2b6",
+		LastContact: at(3),
+		SPIUnknown:  true,
+	})
+	if merged.OnGround || !merged.SPI {
+		t.Errorf("Expected the reported ground state to replace the old one, got on_ground %v spi %v", merged.OnGround, merged.SPI)
+	}
+}
+
+func TestMergeConflictingPositionsPreferTrustedSource(t *testing.T) {
+	m := NewMerger([]string{"sbs", "opensky"})
+
+	merged := m.Merge(types.Flight{}, false, "sbs", types.Flight{
+		ICAO24:       "4ca2b6",
+		Latitude:     types.Float64(51.47),
+		Longitude:    types.Float64(-0.46),
+		TimePosition: types.Time(at(0)),
+		LastContact:  at(0),
+	})
+
+	// OpenSky is a second newer but puts the aircraft 100 km away.
+	merged = m.Merge(merged, true, "opensky", types.Flight{
+		ICAO24:       "4ca2b6",
+		Latitude:     types.Float64(52.37),
+		Longitude:    types.Float64(-0.46),
+		TimePosition: types.Time(at(1)),
+		LastContact:  at(1),
+	})
+
+	if *merged.Latitude != 51.47 || merged.FieldSources["position"] != "sbs" {
+		t.Errorf("Expected the trusted receiver position to win the conflict, got %v from %s", *merged.Latitude, merged.FieldSources["position"])
+	}
+
+	// Outside the conflict window the fresher report is accepted again.
+	merged = m.Merge(merged, true, "opensky", types.Flight{
+		ICAO24:       "4ca2b6",
+		Latitude:     types.Float64(52.37),
+		Longitude:    types.Float64(-0.46),
+		TimePosition: types.Time(at(30)),
+		LastContact:  at(30),
+	})
+
+	if *merged.Latitude != 52.37 {
+		t.Errorf("Expected the fresher position outside the conflict window, got %v", *merged.Latitude)
+	}
+}
+
+func TestMergeUnknownFieldsDoNotOverwrite(t *testing.T) {
+	m := NewMerger(nil)
+
+	merged := m.Merge(types.Flight{}, false, "opensky", types.Flight{
+		ICAO24:      "a1b2c3",
+		Velocity:    types.Float64(250),
+		Squawk:      "7000",
+		LastContact: at(0),
+	})
+	merged = m.Merge(merged, true, "opensky", types.Flight{
+		ICAO24:      "a1b2c3",
+		LastContact: at(15),
+	})
+
+	if merged.Velocity == nil || *merged.Velocity != 250 || merged.Squawk != "7000" {
+		t.Error("Expected a newer update with unknown fields to keep the known values")
+	}
+}
+
+func TestMergeRestoredRecord(t *testing.T) {
+	m := NewMerger(nil)
+
+	restored := types.Flight{
+		ICAO24:       "d4e5f6",
+		Velocity:     types.Float64(220),
+		LastContact:  at(10),
+		FieldSources: map[string]string{"velocity": "opensky"},
+	}
+	merged := m.Merge(restored, true, "sbs", types.Flight{
+		ICAO24:      "d4e5f6",
+		Velocity:    types.Float64(200),
+		LastContact: at(5),
+	})
+
+	if *merged.Velocity != 220 {
+		t.Errorf("Expected the restored value to be fresher, got %v", *merged.Velocity)
+	}
+}
+
+func TestForget(t *testing.T) {
+	m := NewMerger(nil)
+	m.Merge(types.Flight{}, false, "opensky", types.Flight{ICAO24: "abc123", LastContact: at(0)})
+	m.Forget("abc123")
+
+	if _, ok := m.stamps["abc123"]; ok {
+		t.Error("Expected field history to be dropped")
+	}
+}
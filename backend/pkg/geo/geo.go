@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadiusKm is the mean radius of the Earth used for great-circle
+// distances.
+const EarthRadiusKm = 6371.0088
+
+// Distance returns the great-circle distance in kilometres between two
+// points given in degrees, using the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BBox is a latitude/longitude bounding box in degrees, using the same
+// lamin,lomin,lamax,lomax ordering as the OpenSky API.
+type BBox struct {
+	MinLat float64 `json:"lamin"`
+	MinLon float64 `json:"lomin"`
+	MaxLat float64 `json:"lamax"`
+	MaxLon float64 `json:"lomax"`
+}
+
+// ParseBBox parses a "lamin,lomin,lamax,lomax" string.
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, fmt.Errorf("bounding box must be lamin,lomin,lamax,lomax, got %q", s)
+	}
+
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("invalid bounding box coordinate %q: %w", part, err)
+		}
+		values[i] = v
+	}
+
+	box := BBox{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}
+	if err := box.Validate(); err != nil {
+		return BBox{}, err
+	}
+	return box, nil
+}
+
+// Validate checks that the box lies within valid coordinate ranges and
+// that its minimums do not exceed its maximums.
+func (b BBox) Validate() error {
+	if b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 {
+		return fmt.Errorf("bounding box %v is out of range", b)
+	}
+	if b.MinLat > b.MaxLat || b.MinLon > b.MaxLon {
+		return fmt.Errorf("bounding box %v has min greater than max", b)
+	}
+	return nil
+}
+
+// Contains reports whether the point lies inside the box, edges included.
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// Area returns the area of the box in square degrees.
+func (b BBox) Area() float64 {
+	return (b.MaxLat - b.MinLat) * (b.MaxLon - b.MinLon)
+}
+
+func (b BBox) String() string {
+	return fmt.Sprintf("%g,%g,%g,%g", b.MinLat, b.MinLon, b.MaxLat, b.MaxLon)
+}
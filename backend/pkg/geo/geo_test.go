@@ -0,0 +1,51 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseBBox(t *testing.T) {
+	box, err := ParseBBox("35.0, -10.5, 71.0, 40.0")
+	if err != nil {
+		t.Fatalf("ParseBBox returned error: %v", err)
+	}
+
+	want := BBox{MinLat: 35, MinLon: -10.5, MaxLat: 71, MaxLon: 40}
+	if box != want {
+		t.Errorf("Expected %+v, got %+v", want, box)
+	}
+
+	if !box.Contains(48.35, 11.78) {
+		t.Error("Expected Munich to be inside the box")
+	}
+
+	if box.Contains(37.77, -122.42) {
+		t.Error("Expected San Francisco to be outside the box")
+	}
+}
+
+func TestParseBBoxInvalid(t *testing.T) {
+	for _, s := range []string{"", "1,2,3", "a,b,c,d", "10,0,5,1", "0,0,91,1"} {
+		if _, err := ParseBBox(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// London Heathrow to Paris Charles de Gaulle is about 348 km.
+	d := Distance(51.4700, -0.4543, 49.0097, 2.5479)
+	if math.Abs(d-348) > 2 {
+		t.Errorf("Expected about 348 km, got %f", d)
+	}
+
+	if d := Distance(10, 20, 10, 20); d != 0 {
+		t.Errorf("Expected zero distance for the same point, got %f", d)
+	}
+
+	// Across the antimeridian.
+	if d := Distance(0, 179.5, 0, -179.5); math.Abs(d-111.2) > 0.5 {
+		t.Errorf("Expected about 111 km across the antimeridian, got %f", d)
+	}
+}
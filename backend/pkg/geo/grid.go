@@ -0,0 +1,186 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// kmPerDegreeLat is the length of one degree of latitude.
+const kmPerDegreeLat = EarthRadiusKm * math.Pi / 180
+
+// Grid is a spatial index of points bucketed into cells of equal size in
+// degrees. It is not safe for concurrent use.
+type Grid struct {
+	cellDeg float64
+	rows    int
+	cols    int
+	cells   map[cell]map[string]struct{}
+	points  map[string]point
+}
+
+type cell struct {
+	row, col int
+}
+
+type point struct {
+	lat, lon float64
+	cell     cell
+}
+
+// Neighbour is a point found by a radius query.
+type Neighbour struct {
+	ID         string
+	DistanceKm float64
+}
+
+// NewGrid creates an empty index with cells of cellDeg degrees, which
+// should divide 180 evenly.
+func NewGrid(cellDeg float64) *Grid {
+	return &Grid{
+		cellDeg: cellDeg,
+		rows:    int(math.Ceil(180 / cellDeg)),
+		cols:    int(math.Ceil(360 / cellDeg)),
+		cells:   make(map[cell]map[string]struct{}),
+		points:  make(map[string]point),
+	}
+}
+
+// Len returns the number of indexed points.
+func (g *Grid) Len() int {
+	return len(g.points)
+}
+
+// Update inserts the point with the given ID or moves it to a new position.
+func (g *Grid) Update(id string, lat, lon float64) {
+	c := g.cellOf(lat, lon)
+	if old, ok := g.points[id]; ok && old.cell != c {
+		g.removeFromCell(id, old.cell)
+	}
+	g.points[id] = point{lat: lat, lon: lon, cell: c}
+
+	members := g.cells[c]
+	if members == nil {
+		members = make(map[string]struct{})
+		g.cells[c] = members
+	}
+	members[id] = struct{}{}
+}
+
+// Remove drops the point with the given ID, if it is indexed.
+func (g *Grid) Remove(id string) {
+	if old, ok := g.points[id]; ok {
+		g.removeFromCell(id, old.cell)
+		delete(g.points, id)
+	}
+}
+
+// InBBox returns the IDs of the points inside the box, in no particular
+// order.
+func (g *Grid) InBBox(b BBox) []string {
+	minRow, maxRow := g.row(b.MinLat), g.row(b.MaxLat)
+	minCol, maxCol := g.col(b.MinLon), g.col(b.MaxLon)
+
+	var ids []string
+	collect := func(members map[string]struct{}) {
+		for id := range members {
+			p := g.points[id]
+			if b.Contains(p.lat, p.lon) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	// A box covering more cells than are occupied is cheaper to answer by
+	// walking the occupied cells.
+	if (maxRow-minRow+1)*(maxCol-minCol+1) > len(g.cells) {
+		for _, members := range g.cells {
+			collect(members)
+		}
+		return ids
+	}
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			collect(g.cells[cell{row, col}])
+		}
+	}
+	return ids
+}
+
+// Nearby returns the points within radiusKm of the given position, nearest
+// first, using great-circle distances.
+func (g *Grid) Nearby(lat, lon, radiusKm float64) []Neighbour {
+	dLat := radiusKm / kmPerDegreeLat
+	minRow, maxRow := g.row(lat-dLat), g.row(lat+dLat)
+
+	// Scan every column when the circle reaches a pole, otherwise only the
+	// columns spanned by its widest longitude extent.
+	firstCol, cols := 0, g.cols
+	if lat+dLat < 90 && lat-dLat > -90 {
+		delta := dLat * math.Pi / 180
+		dLon := math.Asin(math.Sin(delta)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+		first := int(math.Floor((lon - dLon + 180) / g.cellDeg))
+		last := int(math.Floor((lon + dLon + 180) / g.cellDeg))
+		if span := last - first + 1; span < g.cols {
+			firstCol, cols = g.col(lon-dLon), span
+		}
+	}
+
+	var found []Neighbour
+	for row := minRow; row <= maxRow; row++ {
+		for i := 0; i < cols; i++ {
+			col := (firstCol + i) % g.cols
+			for id := range g.cells[cell{row, col}] {
+				p := g.points[id]
+				if d := Distance(lat, lon, p.lat, p.lon); d <= radiusKm {
+					found = append(found, Neighbour{ID: id, DistanceKm: d})
+				}
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].DistanceKm != found[j].DistanceKm {
+			return found[i].DistanceKm < found[j].DistanceKm
+		}
+		return found[i].ID < found[j].ID
+	})
+	return found
+}
+
+func (g *Grid) cellOf(lat, lon float64) cell {
+	return cell{g.row(lat), g.col(lon)}
+}
+
+// row returns the row of a latitude, clamped to the poles.
+func (g *Grid) row(lat float64) int {
+	r := int(math.Floor((lat + 90) / g.cellDeg))
+	if r < 0 {
+		return 0
+	}
+	if r >= g.rows {
+		return g.rows - 1
+	}
+	return r
+}
+
+// col returns the column of a longitude, wrapping around the antimeridian.
+// The antimeridian itself belongs to the last column.
+func (g *Grid) col(lon float64) int {
+	if lon == 180 {
+		return g.cols - 1
+	}
+	c := int(math.Floor((lon + 180) / g.cellDeg))
+	c %= g.cols
+	if c < 0 {
+		c += g.cols
+	}
+	return c
+}
+
+func (g *Grid) removeFromCell(id string, c cell) {
+	members := g.cells[c]
+	delete(members, id)
+	if len(members) == 0 {
+		delete(g.cells, c)
+	}
+}
@@ -0,0 +1,134 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestGridUpdateAndRemove(t *testing.T) {
+	g := NewGrid(1)
+	g.Update("a", 48.35, 11.78)
+	g.Update("b", 51.47, -0.45)
+	g.Update("a", 49.01, 2.55)
+
+	if g.Len() != 2 {
+		t.Fatalf("Expected 2 points, got %d", g.Len())
+	}
+
+	europe := BBox{MinLat: 45, MinLon: 0, MaxLat: 50, MaxLon: 10}
+	if ids := g.InBBox(europe); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("Expected only the moved point in the box, got %v", ids)
+	}
+
+	g.Remove("a")
+	g.Remove("missing")
+	if ids := g.InBBox(europe); len(ids) != 0 {
+		t.Errorf("Expected no points after removal, got %v", ids)
+	}
+
+	if g.Len() != 1 || len(g.cells) != 1 {
+		t.Errorf("Expected 1 point in 1 cell, got %d in %d", g.Len(), len(g.cells))
+	}
+}
+
+func TestGridNearby(t *testing.T) {
+	g := NewGrid(1)
+	g.Update("heathrow", 51.4700, -0.4543)
+	g.Update("gatwick", 51.1537, -0.1821)
+	g.Update("cdg", 49.0097, 2.5479)
+
+	found := g.Nearby(51.5074, -0.1278, 50)
+	if len(found) != 2 || found[0].ID != "heathrow" || found[1].ID != "gatwick" {
+		t.Fatalf("Expected heathrow then gatwick, got %+v", found)
+	}
+
+	if found[0].DistanceKm > found[1].DistanceKm {
+		t.Errorf("Expected results nearest first, got %+v", found)
+	}
+}
+
+func TestGridNearbyAntimeridian(t *testing.T) {
+	g := NewGrid(1)
+	g.Update("east", 0, 179.9)
+	g.Update("west", 0, -179.9)
+	g.Update("edge", 0, 180)
+
+	if found := g.Nearby(0, 179.95, 50); len(found) != 3 {
+		t.Errorf("Expected all points across the antimeridian, got %+v", found)
+	}
+
+	if ids := g.InBBox(BBox{MinLat: -1, MinLon: 179, MaxLat: 1, MaxLon: 180}); len(ids) != 2 {
+		t.Errorf("Expected east and edge in the box, got %v", ids)
+	}
+}
+
+// TestGridMatchesScan compares the index against a linear scan of random
+// points, including ones near the poles.
+func TestGridMatchesScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	g := NewGrid(1)
+	points := make(map[string][2]float64)
+	for i := 0; i < 5000; i++ {
+		id := strconv.Itoa(i)
+		lat, lon := rng.Float64()*180-90, rng.Float64()*360-180
+		points[id] = [2]float64{lat, lon}
+		g.Update(id, lat, lon)
+	}
+
+	for i := 0; i < 50; i++ {
+		lat, lon := rng.Float64()*180-90, rng.Float64()*360-180
+		radius := rng.Float64() * 2000
+
+		var want []string
+		for id, p := range points {
+			if Distance(lat, lon, p[0], p[1]) <= radius {
+				want = append(want, id)
+			}
+		}
+
+		found := g.Nearby(lat, lon, radius)
+		if len(found) != len(want) {
+			t.Fatalf("Nearby(%f, %f, %f): expected %d points, got %d", lat, lon, radius, len(want), len(found))
+		}
+
+		box := BBox{
+			MinLat: math.Max(lat-5, -90),
+			MinLon: math.Max(lon-10, -180),
+			MaxLat: math.Min(lat+5, 90),
+			MaxLon: math.Min(lon+10, 180),
+		}
+		want = want[:0]
+		for id, p := range points {
+			if box.Contains(p[0], p[1]) {
+				want = append(want, id)
+			}
+		}
+		got := g.InBBox(box)
+		sort.Strings(want)
+		sort.Strings(got)
+		if len(got) != len(want) {
+			t.Fatalf("InBBox(%v): expected %d points, got %d", box, len(want), len(got))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("InBBox(%v): expected %v, got %v", box, want, got)
+			}
+		}
+	}
+}
+
+func BenchmarkGridNearby(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	g := NewGrid(1)
+	for i := 0; i < 20000; i++ {
+		g.Update(strconv.Itoa(i), rng.Float64()*180-90, rng.Float64()*360-180)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Nearby(48.35, 11.78, 250)
+	}
+}
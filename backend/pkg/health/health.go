@@ -3,6 +3,7 @@ package health
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 	"github.com/real-time-dashboard/backend/pkg/log"
 )
@@ -15,7 +16,25 @@ type HealthStatus struct {
 	Uptime    string            `json:"uptime"`
 }
 
-var startTime = time.Now()
+// Check reports the status of a component of the service, such as the
+// circuit breaker in front of an upstream, and whether that status is
+// healthy.
+type Check func() (status string, healthy bool)
+
+var (
+	startTime = time.Now()
+	checksMu  sync.RWMutex
+	checks    = map[string]Check{}
+)
+
+// RegisterCheck adds a component to the services reported by HealthHandler.
+// An unhealthy check marks the service as degraded without failing the
+// liveness probe.
+func RegisterCheck(name string, check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	checks[name] = check
+}
 
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -30,6 +49,16 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 		Uptime: time.Since(startTime).String(),
 	}
 	
+	checksMu.RLock()
+	for name, check := range checks {
+		status, healthy := check()
+		health.Services[name] = status
+		if !healthy {
+			health.Status = "degraded"
+		}
+	}
+	checksMu.RUnlock()
+	
 	if err := json.NewEncoder(w).Encode(health); err != nil {
 		log.LogError("Failed to encode health response: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -0,0 +1,136 @@
+// Package leader elects a single leader among the replicas of a service
+// using a Redis lock with a lease.
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"github.com/redis/go-redis/v9"
+)
+
+// renewScript extends the lease if it is still held by ARGV[1].
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock if it is still held by ARGV[1].
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Elector competes for a Redis lock held for a lease that the leader keeps
+// renewing. A leader that cannot renew in time steps down, so at most one
+// replica leads once the lease of a failed leader has run out.
+type Elector struct {
+	client   *redis.Client
+	key      string
+	id       string
+	lease    time.Duration
+	onChange func(leader bool)
+	leader   int32
+}
+
+// NewElector creates an elector for the lock at key. id identifies this
+// replica and onChange, which may be nil, is called on every change of
+// leadership.
+func NewElector(client *redis.Client, key, id string, lease time.Duration, onChange func(leader bool)) *Elector {
+	return &Elector{client: client, key: key, id: id, lease: lease, onChange: onChange}
+}
+
+// ID returns the identity of this replica.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this replica currently holds the lock.
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run competes for leadership until ctx is cancelled. Each time the lock is
+// acquired, lead is called with a context that is cancelled when
+// leadership is lost; the lock is released once lead returns.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	interval := e.lease / 3
+	for {
+		acquired, err := e.client.SetNX(ctx, e.key, e.id, e.lease).Result()
+		if err == nil && acquired {
+			e.lead(ctx, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lead runs lead while renewing the lease, until either ctx is cancelled
+// or a renewal fails.
+func (e *Elector) lead(ctx context.Context, lead func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.setLeader(true)
+	go func() {
+		defer close(done)
+		lead(leaderCtx)
+	}()
+
+	// Without a successful renewal the lease runs out at renewed+lease, by
+	// which time another replica may lead; step down one interval earlier.
+	interval := e.lease / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-done:
+			break loop
+		case now := <-ticker.C:
+			held, err := e.renew(leaderCtx)
+			if err == nil && !held {
+				break loop
+			}
+			if err == nil {
+				renewed = now
+			} else if now.Sub(renewed) >= e.lease-interval {
+				break loop
+			}
+		}
+	}
+
+	cancel()
+	<-done
+	e.setLeader(false)
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), time.Second)
+	defer cancelRelease()
+	releaseScript.Run(releaseCtx, e.client, []string{e.key}, e.id)
+}
+
+// renew extends the lease, reporting whether it is still held.
+func (e *Elector) renew(ctx context.Context) (bool, error) {
+	n, err := renewScript.Run(ctx, e.client, []string{e.key}, e.id, e.lease.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (e *Elector) setLeader(leader bool) {
+	var v int32
+	if leader {
+		v = 1
+	}
+	if atomic.SwapInt32(&e.leader, v) != v && e.onChange != nil {
+		e.onChange(leader)
+	}
+}
@@ -0,0 +1,102 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testLease = 150 * time.Millisecond
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startElector runs an elector whose lead function blocks until leadership
+// is lost.
+func startElector(ctx context.Context, client *redis.Client, id string) (*Elector, chan struct{}) {
+	e := NewElector(client, "test:leader", id, testLease, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, func(ctx context.Context) { <-ctx.Done() })
+	}()
+	return e, done
+}
+
+func TestElectorFailover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	a, doneA := startElector(ctxA, client, "a")
+	waitFor(t, "a to lead", a.IsLeader)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	b, _ := startElector(ctxB, client, "b")
+
+	time.Sleep(2 * testLease)
+	if b.IsLeader() {
+		t.Fatal("Expected only one leader")
+	}
+	if got, _ := mr.Get("test:leader"); got != "a" {
+		t.Errorf("Expected the lock to be held by a, got %q", got)
+	}
+
+	// Shutting a down releases the lock for b to take over.
+	cancelA()
+	<-doneA
+	if a.IsLeader() {
+		t.Error("Expected a to step down on shutdown")
+	}
+	waitFor(t, "b to lead", b.IsLeader)
+}
+
+func TestElectorStepsDownWhenLockIsLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	changes := make(chan bool, 2)
+	e := NewElector(client, "test:leader", "a", testLease, func(leader bool) {
+		changes <- leader
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := make(chan struct{})
+	go e.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(lost)
+	})
+	waitFor(t, "leadership", e.IsLeader)
+
+	// Another replica took over after the lease ran out.
+	mr.Set("test:leader", "b")
+	select {
+	case <-lost:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the lead context to be cancelled")
+	}
+
+	if gained, lostLead := <-changes, <-changes; !gained || lostLead {
+		t.Errorf("Expected to be told of gaining and losing leadership, got %v then %v", gained, lostLead)
+	}
+	if e.IsLeader() {
+		t.Error("Expected to have stepped down")
+	}
+	if got, _ := mr.Get("test:leader"); got != "b" {
+		t.Errorf("Expected the other replica's lock to be left alone, got %q", got)
+	}
+}
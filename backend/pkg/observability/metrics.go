@@ -29,10 +29,108 @@ var (
 		},
 	)
 
+	WebSocketRejectedUpgrades = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "websocket_rejected_upgrades_total",
+			Help: "Total number of WebSocket upgrades rejected by a connection cap, by reason",
+		},
+		[]string{"reason"},
+	)
+
 	FlightDataUpdates = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "flight_data_updates_total",
 			Help: "Total number of flight data updates",
 		},
 	)
+
+	FlightSourceCircuitState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "flight_source_circuit_state",
+			Help: "Circuit breaker state per flight source (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"source"},
+	)
+
+	FlightFetchErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flight_fetch_errors_total",
+			Help: "Total number of failed flight source fetches",
+		},
+		[]string{"source"},
+	)
+
+	FusionPositionConflicts = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flight_fusion_position_conflicts_total",
+			Help: "Total number of position reports that disagreed with another source",
+		},
+	)
+
+	LiveAircraft = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "flight_store_live_aircraft",
+			Help: "Number of aircraft currently tracked",
+		},
+	)
+
+	EvictedAircraft = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flight_store_evicted_total",
+			Help: "Total number of aircraft evicted after their last contact exceeded FLIGHT_TTL",
+		},
+	)
+
+	Leader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "flight_data_leader",
+			Help: "Whether this replica is the leader that fetches from upstream (1) or a follower (0)",
+		},
+	)
+
+	LeaderTransitions = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "flight_data_leader_transitions_total",
+			Help: "Total number of times this replica gained or lost leadership",
+		},
+	)
+
+	FlightEventsPublished = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flight_events_published_total",
+			Help: "Total number of flight events written to Kafka, by result (delivered or failed)",
+		},
+		[]string{"result"},
+	)
+
+	FlightEventBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "flight_events_batch_size",
+			Help:    "Number of flight events per batch written to Kafka",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 7),
+		},
+	)
+
+	FlightEventDeliveryLatency = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "flight_events_delivery_seconds",
+			Help:    "Time from publishing a flight event until Kafka acknowledged it",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	FlightRecordsInvalid = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flight_records_invalid_total",
+			Help: "Total number of flight records rejected by validation, by invalid field",
+		},
+		[]string{"field"},
+	)
+
+	OpenSkyCreditsRemaining = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "opensky_credits_remaining",
+			Help: "OpenSky API credits remaining as reported by X-Rate-Limit-Remaining",
+		},
+	)
 )
\ No newline at end of file
@@ -0,0 +1,159 @@
+// Package query filters, sorts and paginates flights for the flight APIs.
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Filter selects flights. Unset criteria match every flight; a criterion
+// on a field the flight does not report never matches.
+type Filter struct {
+	BBox           *geo.BBox
+	ICAO24         map[string]bool
+	OriginCountry  string
+	CallsignPrefix string
+	OnGround       *bool
+	MinAltitude    *float64
+	MaxAltitude    *float64
+	MinVelocity    *float64
+	MaxVelocity    *float64
+	Since          time.Time
+}
+
+// ParseFilter reads a filter from the query parameters bbox, icao24 (a
+// comma separated list), origin_country, callsign, on_ground, min_altitude, max_altitude,
+// min_velocity, max_velocity and since.
+func ParseFilter(values url.Values) (Filter, error) {
+	var f Filter
+	var err error
+
+	if s := values.Get("bbox"); s != "" {
+		box, err := geo.ParseBBox(s)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.BBox = &box
+	}
+	if s := values.Get("icao24"); s != "" {
+		f.ICAO24 = ICAO24Set(strings.Split(s, ","))
+	}
+	f.OriginCountry = strings.TrimSpace(values.Get("origin_country"))
+	f.CallsignPrefix = strings.ToUpper(strings.TrimSpace(values.Get("callsign")))
+
+	if s := values.Get("on_ground"); s != "" {
+		onGround, err := strconv.ParseBool(s)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid on_ground %q", s)
+		}
+		f.OnGround = &onGround
+	}
+
+	if f.MinAltitude, err = parseFloat(values, "min_altitude"); err != nil {
+		return Filter{}, err
+	}
+	if f.MaxAltitude, err = parseFloat(values, "max_altitude"); err != nil {
+		return Filter{}, err
+	}
+	if f.MinVelocity, err = parseFloat(values, "min_velocity"); err != nil {
+		return Filter{}, err
+	}
+	if f.MaxVelocity, err = parseFloat(values, "max_velocity"); err != nil {
+		return Filter{}, err
+	}
+
+	if s := values.Get("since"); s != "" {
+		if f.Since, err = ParseTime(s); err != nil {
+			return Filter{}, err
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether the flight satisfies every criterion of the filter.
+func (f Filter) Match(flight types.Flight) bool {
+	if f.BBox != nil && (!flight.HasPosition() || !f.BBox.Contains(*flight.Latitude, *flight.Longitude)) {
+		return false
+	}
+	if len(f.ICAO24) > 0 && !f.ICAO24[strings.ToLower(flight.ICAO24)] {
+		return false
+	}
+	if f.OriginCountry != "" && !strings.EqualFold(flight.OriginCountry, f.OriginCountry) {
+		return false
+	}
+	if f.CallsignPrefix != "" && !strings.HasPrefix(strings.ToUpper(flight.Callsign), f.CallsignPrefix) {
+		return false
+	}
+	if f.OnGround != nil && flight.OnGround != *f.OnGround {
+		return false
+	}
+	if f.MinAltitude != nil || f.MaxAltitude != nil {
+		altitude, ok := flight.Altitude()
+		if !ok || !inRange(altitude, f.MinAltitude, f.MaxAltitude) {
+			return false
+		}
+	}
+	if f.MinVelocity != nil || f.MaxVelocity != nil {
+		if flight.Velocity == nil || !inRange(*flight.Velocity, f.MinVelocity, f.MaxVelocity) {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && flight.LastSeen().Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// IsZero reports whether the filter has no criteria and so matches every
+// flight.
+func (f Filter) IsZero() bool {
+	return f.BBox == nil && len(f.ICAO24) == 0 && f.OriginCountry == "" && f.CallsignPrefix == "" &&
+		f.OnGround == nil && f.MinAltitude == nil && f.MaxAltitude == nil &&
+		f.MinVelocity == nil && f.MaxVelocity == nil && f.Since.IsZero()
+}
+
+// ICAO24Set builds the ICAO24 criterion of a filter from a list of
+// addresses, ignoring case and blanks.
+func ICAO24Set(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id = strings.ToLower(strings.TrimSpace(id)); id != "" {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+func inRange(v float64, min, max *float64) bool {
+	return (min == nil || v >= *min) && (max == nil || v <= *max)
+}
+
+func parseFloat(values url.Values, key string) (*float64, error) {
+	s := values.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, s)
+	}
+	return &v, nil
+}
+
+// ParseTime parses a since parameter, accepting RFC 3339 timestamps and Unix
+// seconds.
+func ParseTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q, expected RFC 3339 or Unix seconds", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,87 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func TestParseFilter(t *testing.T) {
+	values, _ := url.ParseQuery("bbox=35,-10,71,40&icao24=3C6444,%204ca2b6&origin_country=germany&callsign=dlh&on_ground=false&min_altitude=1000&max_velocity=300&since=1700000000")
+	f, err := ParseFilter(values)
+	if err != nil {
+		t.Fatalf("ParseFilter returned error: %v", err)
+	}
+
+	now := time.Unix(1700000100, 0)
+	lufthansa := types.Flight{
+		ICAO24:        "3c6444",
+		Callsign:      "DLH4AB",
+		OriginCountry: "Germany",
+		Latitude:      types.Float64(48.35),
+		Longitude:     types.Float64(11.78),
+		BaroAltitude:  types.Float64(11000),
+		Velocity:      types.Float64(240),
+		LastContact:   now,
+	}
+	if !f.Match(lufthansa) {
+		t.Error("Expected flight to match every criterion")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*types.Flight)
+	}{
+		{"outside bbox", func(fl *types.Flight) { fl.Longitude = types.Float64(-122.4) }},
+		{"no position", func(fl *types.Flight) { fl.Latitude = nil }},
+		{"other aircraft", func(fl *types.Flight) { fl.ICAO24 = "3c6445" }},
+		{"other country", func(fl *types.Flight) { fl.OriginCountry = "France" }},
+		{"other callsign", func(fl *types.Flight) { fl.Callsign = "AFR123" }},
+		{"on ground", func(fl *types.Flight) { fl.OnGround = true }},
+		{"too low", func(fl *types.Flight) { fl.BaroAltitude = types.Float64(500) }},
+		{"no altitude", func(fl *types.Flight) { fl.BaroAltitude = nil }},
+		{"too fast", func(fl *types.Flight) { fl.Velocity = types.Float64(310) }},
+		{"too old", func(fl *types.Flight) { fl.LastContact = time.Unix(1690000000, 0) }},
+	}
+	for _, tt := range tests {
+		flight := lufthansa
+		tt.modify(&flight)
+		if f.Match(flight) {
+			t.Errorf("%s: expected flight not to match", tt.name)
+		}
+	}
+}
+
+func TestFilterIsZero(t *testing.T) {
+	f, _ := ParseFilter(url.Values{})
+	if !f.IsZero() || !f.Match(types.Flight{}) {
+		t.Error("Expected an empty filter to match everything")
+	}
+
+	f, _ = ParseFilter(url.Values{"icao24": {"3c6444"}})
+	if f.IsZero() {
+		t.Error("Expected an ICAO24 list to be a criterion")
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	for _, q := range []string{"bbox=1,2,3", "on_ground=maybe", "min_altitude=high", "since=yesterday"} {
+		values, _ := url.ParseQuery(q)
+		if _, err := ParseFilter(values); err == nil {
+			t.Errorf("Expected error for %q", q)
+		}
+	}
+}
+
+func TestParseFilterSinceRFC3339(t *testing.T) {
+	values := url.Values{"since": {"2024-01-02T15:04:05Z"}}
+	f, err := ParseFilter(values)
+	if err != nil {
+		t.Fatalf("ParseFilter returned error: %v", err)
+	}
+
+	if want := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC); !f.Since.Equal(want) {
+		t.Errorf("Expected since %v, got %v", want, f.Since)
+	}
+}
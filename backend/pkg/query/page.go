@@ -0,0 +1,207 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Page sizes of GET /flights. DefaultLimit applies when the client does
+// not pass a limit, and MaxLimit is the largest it may request.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the
+// requested sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Fields flights can be sorted by.
+var sortFields = map[string]bool{
+	"icao24":       true,
+	"callsign":     true,
+	"altitude":     true,
+	"velocity":     true,
+	"last_contact": true,
+}
+
+// Sort is an ordering of flights by a single field. Ties are broken by
+// ICAO24 so that the order is stable between requests, and flights that do
+// not report the field always come last.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a field name, prefixed with "-" for descending order.
+// An empty string sorts by ICAO24.
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return Sort{Field: "icao24"}, nil
+	}
+	desc := strings.HasPrefix(s, "-")
+	field := strings.TrimPrefix(s, "-")
+	if !sortFields[field] {
+		return Sort{}, fmt.Errorf("cannot sort by %q", field)
+	}
+	return Sort{Field: field, Desc: desc}, nil
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// position is where a flight falls in a sort order. It is also the
+// content of a cursor, so that a page resumes after the last flight served
+// even when flights were added or removed in between.
+type position struct {
+	Sort    string  `json:"s"`
+	Missing bool    `json:"m,omitempty"`
+	Num     float64 `json:"n,omitempty"`
+	Str     string  `json:"v,omitempty"`
+	ICAO24  string  `json:"i"`
+}
+
+func (s Sort) position(f types.Flight) position {
+	p := position{Sort: s.String(), ICAO24: f.ICAO24}
+	switch s.Field {
+	case "callsign":
+		p.Str = f.Callsign
+		p.Missing = f.Callsign == ""
+	case "altitude":
+		altitude, ok := f.Altitude()
+		p.Num, p.Missing = altitude, !ok
+	case "velocity":
+		if f.Velocity != nil {
+			p.Num = *f.Velocity
+		} else {
+			p.Missing = true
+		}
+	case "last_contact":
+		p.Num = float64(f.LastSeen().UnixNano())
+	}
+	return p
+}
+
+// compare orders two positions, returning a negative number when a comes
+// first.
+func (s Sort) compare(a, b position) int {
+	if a.Missing != b.Missing {
+		if a.Missing {
+			return 1
+		}
+		return -1
+	}
+
+	c := 0
+	if !a.Missing {
+		switch {
+		case a.Num < b.Num, a.Num == b.Num && a.Str < b.Str:
+			c = -1
+		case a.Num > b.Num, a.Num == b.Num && a.Str > b.Str:
+			c = 1
+		}
+	}
+	if s.Desc {
+		c = -c
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ICAO24, b.ICAO24)
+}
+
+// Paginate sorts flights in place and returns the page of at most limit
+// flights that follows cursor, together with the cursor of the next page.
+// A limit of zero returns every remaining flight. The next cursor is empty
+// on the last page.
+func Paginate(flights []types.Flight, s Sort, cursor string, limit int) ([]types.Flight, string, error) {
+	if limit < 0 {
+		return nil, "", fmt.Errorf("invalid limit %d", limit)
+	}
+
+	positions := make([]position, len(flights))
+	for i, flight := range flights {
+		positions[i] = s.position(flight)
+	}
+	sort.Sort(byPosition{s, flights, positions})
+
+	start := 0
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil || after.Sort != s.String() {
+			return nil, "", ErrInvalidCursor
+		}
+		start = sort.Search(len(positions), func(i int) bool {
+			return s.compare(positions[i], after) > 0
+		})
+	}
+
+	page := flights[start:]
+	if limit == 0 || len(page) <= limit {
+		return page, "", nil
+	}
+	page = page[:limit]
+	return page, encodeCursor(positions[start+limit-1]), nil
+}
+
+// ParseLimit parses a page size, defaulting to defaultLimit and capping
+// it at MaxLimit.
+func ParseLimit(s string, defaultLimit int) (int, error) {
+	if s == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", s)
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return limit, nil
+}
+
+type byPosition struct {
+	sort      Sort
+	flights   []types.Flight
+	positions []position
+}
+
+func (b byPosition) Len() int {
+	return len(b.flights)
+}
+
+func (b byPosition) Less(i, j int) bool {
+	return b.sort.compare(b.positions[i], b.positions[j]) < 0
+}
+
+func (b byPosition) Swap(i, j int) {
+	b.flights[i], b.flights[j] = b.flights[j], b.flights[i]
+	b.positions[i], b.positions[j] = b.positions[j], b.positions[i]
+}
+
+func encodeCursor(p position) string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (position, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position{}, err
+	}
+	var p position
+	if err := json.Unmarshal(data, &p); err != nil {
+		return position{}, err
+	}
+	return p, nil
+}
@@ -0,0 +1,133 @@
+package query
+
+import (
+	"testing"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func testFlights() []types.Flight {
+	return []types.Flight{
+		{ICAO24: "c00001", BaroAltitude: types.Float64(3000)},
+		{ICAO24: "a00001", BaroAltitude: types.Float64(10000)},
+		{ICAO24: "b00001"},
+		{ICAO24: "d00001", BaroAltitude: types.Float64(3000)},
+		{ICAO24: "e00001", GeoAltitude: types.Float64(500)},
+	}
+}
+
+func icaos(flights []types.Flight) []string {
+	ids := make([]string, len(flights))
+	for i, f := range flights {
+		ids[i] = f.ICAO24
+	}
+	return ids
+}
+
+func TestPaginateSortsStably(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"a00001", "b00001", "c00001", "d00001", "e00001"}},
+		{"altitude", []string{"e00001", "c00001", "d00001", "a00001", "b00001"}},
+		{"-altitude", []string{"a00001", "c00001", "d00001", "e00001", "b00001"}},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSort(tt.sort)
+		if err != nil {
+			t.Fatalf("ParseSort(%q) returned error: %v", tt.sort, err)
+		}
+
+		page, next, err := Paginate(testFlights(), s, "", 0)
+		if err != nil {
+			t.Fatalf("Paginate returned error: %v", err)
+		}
+
+		if got := icaos(page); len(got) != len(tt.want) || next != "" {
+			t.Fatalf("sort %q: expected %v without next cursor, got %v next %q", tt.sort, tt.want, got, next)
+		}
+		for i, id := range icaos(page) {
+			if id != tt.want[i] {
+				t.Errorf("sort %q: expected %v, got %v", tt.sort, tt.want, icaos(page))
+				break
+			}
+		}
+	}
+}
+
+func TestPaginateCursor(t *testing.T) {
+	s, _ := ParseSort("-altitude")
+	var seen []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, next, err := Paginate(testFlights(), s, cursor, 2)
+		if err != nil {
+			t.Fatalf("Paginate returned error: %v", err)
+		}
+		seen = append(seen, icaos(page)...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	want := []string{"a00001", "c00001", "d00001", "e00001", "b00001"}
+	if len(seen) != len(want) {
+		t.Fatalf("Expected %v across pages, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("Expected %v across pages, got %v", want, seen)
+		}
+	}
+}
+
+func TestPaginateCursorSurvivesRemoval(t *testing.T) {
+	s, _ := ParseSort("")
+	_, next, _ := Paginate(testFlights(), s, "", 2)
+
+	// b00001, the last flight of the first page, disappears between requests.
+	flights := testFlights()
+	flights = append(flights[:2], flights[3:]...)
+
+	page, _, err := Paginate(flights, s, next, 2)
+	if err != nil {
+		t.Fatalf("Paginate returned error: %v", err)
+	}
+
+	if got := icaos(page); len(got) != 2 || got[0] != "c00001" || got[1] != "d00001" {
+		t.Errorf("Expected [c00001 d00001], got %v", got)
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	byAltitude, _ := ParseSort("altitude")
+	_, next, _ := Paginate(testFlights(), byAltitude, "", 1)
+
+	byICAO, _ := ParseSort("icao24")
+	for _, cursor := range []string{"not-a-cursor", next} {
+		if _, _, err := Paginate(testFlights(), byICAO, cursor, 1); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", cursor, err)
+		}
+	}
+}
+
+func TestParseSortAndLimit(t *testing.T) {
+	if _, err := ParseSort("squawk"); err == nil {
+		t.Error("Expected error for unsupported sort field")
+	}
+
+	if limit, err := ParseLimit("5000", DefaultLimit); err != nil || limit != MaxLimit {
+		t.Errorf("Expected limit capped at %d, got %d (%v)", MaxLimit, limit, err)
+	}
+	if limit, err := ParseLimit("", DefaultLimit); err != nil || limit != DefaultLimit {
+		t.Errorf("Expected the default limit %d, got %d (%v)", DefaultLimit, limit, err)
+	}
+
+	for _, s := range []string{"0", "-1", "ten"} {
+		if _, err := ParseLimit(s, DefaultLimit); err == nil {
+			t.Errorf("Expected error for limit %q", s)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package schema
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/riferrei/srclient"
+)
+
+// FlightSubject is the registry subject of the FlightAvro schema in
+// schemas/flight-avro.avsc.
+const FlightSubject = "flights-value"
+
+// magicByte starts every message in the Confluent wire format. It is
+// followed by the schema ID as a big-endian uint32 and the Avro body.
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// ErrNotAvro is returned when decoding a message that is not in the
+// Confluent wire format.
+var ErrNotAvro = errors.New("message is not in the Confluent Avro wire format")
+
+// AvroCodec encodes flights as FlightAvro records in the Confluent wire
+// format. Flights are encoded with the latest schema of the subject and
+// decoded with whichever schema the message names.
+//
+// Unknown values are encoded as null and times in Unix milliseconds, so a
+// flight survives a round trip apart from the sources it was merged from.
+// The timestamp is when the aircraft was last seen. Records of the first
+// version of the schema, which had no nullable fields, are decoded with
+// NaN as unknown, only the timestamp as the last contact and the one
+// altitude as barometric, and with the fields it lacked unknown.
+type AvroCodec struct {
+	registry *srclient.SchemaRegistryClient
+	schema   *srclient.Schema
+	fields   []avroField
+}
+
+// NewAvroCodec loads the latest schema of subject from the registry.
+func NewAvroCodec(registry *srclient.SchemaRegistryClient, subject string) (*AvroCodec, error) {
+	schema, err := registry.GetLatestSchema(subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema %s: %w", subject, err)
+	}
+	fields, ok := recordFields(json.RawMessage(schema.Schema()))
+	if !ok {
+		return nil, fmt.Errorf("schema %s is not a record", subject)
+	}
+	return &AvroCodec{registry: registry, schema: schema, fields: fields}, nil
+}
+
+// SchemaID returns the ID of the schema flights are encoded with.
+func (c *AvroCodec) SchemaID() int {
+	return c.schema.ID()
+}
+
+func (c *AvroCodec) Encode(flight types.Flight) ([]byte, error) {
+	header := make([]byte, headerSize, 64)
+	header[0] = magicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(c.schema.ID()))
+
+	data, err := c.schema.Codec().BinaryFromNative(header, fitRecord(nil, "", c.fields, toNative(flight)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode flight %s: %w", flight.ICAO24, err)
+	}
+	return data, nil
+}
+
+func (c *AvroCodec) Decode(data []byte) (types.Flight, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return types.Flight{}, ErrNotAvro
+	}
+
+	id := int(binary.BigEndian.Uint32(data[1:headerSize]))
+	schema := c.schema
+	if id != schema.ID() {
+		var err error
+		if schema, err = c.registry.GetSchema(id); err != nil {
+			return types.Flight{}, fmt.Errorf("failed to load schema %d: %w", id, err)
+		}
+	}
+
+	native, _, err := schema.Codec().NativeFromBinary(data[headerSize:])
+	if err != nil {
+		return types.Flight{}, fmt.Errorf("failed to decode flight: %w", err)
+	}
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return types.Flight{}, fmt.Errorf("expected a record, got %T", native)
+	}
+	return fromNative(record), nil
+}
+
+// toNative converts a flight to a FlightAvro record of plain values, with
+// nil for unknown ones. fitRecord shapes it to a version of the schema.
+func toNative(f types.Flight) map[string]interface{} {
+	var timestamp int64
+	if seen := f.LastSeen(); !seen.IsZero() {
+		timestamp = seen.UnixMilli()
+	}
+	var timePosition, onGround, spi, sensors interface{}
+	if f.TimePosition != nil {
+		timePosition = f.TimePosition.UnixMilli()
+	}
+	if !f.OnGroundUnknown {
+		onGround = f.OnGround
+	}
+	if !f.SPIUnknown {
+		spi = f.SPI
+	}
+	if f.Sensors != nil {
+		items := make([]interface{}, len(f.Sensors))
+		for i, sensor := range f.Sensors {
+			items[i] = int32(sensor)
+		}
+		sensors = items
+	}
+
+	return map[string]interface{}{
+		"timestamp":     timestamp,
+		"icao24":        f.ICAO24,
+		"callsign":      f.Callsign,
+		"originCountry": f.OriginCountry,
+		"position": map[string]interface{}{
+			"latitude":    double(f.Latitude),
+			"longitude":   double(f.Longitude),
+			"altitude":    double(f.BaroAltitude),
+			"geoAltitude": double(f.GeoAltitude),
+		},
+		"velocity": map[string]interface{}{
+			"speed":        double(f.Velocity),
+			"heading":      double(f.TrueTrack),
+			"verticalRate": double(f.VerticalRate),
+		},
+		"lastContact":    millis(f.LastContact),
+		"lastUpdated":    millis(f.LastUpdated),
+		"timePosition":   timePosition,
+		"onGround":       onGround,
+		"spi":            spi,
+		"squawk":         f.Squawk,
+		"positionSource": int32(f.PositionSource),
+		"category":       int32(f.Category),
+		"sensors":        sensors,
+	}
+}
+
+// fromNative converts a decoded FlightAvro record to a flight.
+func fromNative(record map[string]interface{}) types.Flight {
+	position, _ := record["position"].(map[string]interface{})
+	velocity, _ := record["velocity"].(map[string]interface{})
+
+	f := types.Flight{
+		Latitude:     known(position["latitude"]),
+		Longitude:    known(position["longitude"]),
+		BaroAltitude: known(position["altitude"]),
+		GeoAltitude:  known(position["geoAltitude"]),
+		Velocity:     known(velocity["speed"]),
+		TrueTrack:    known(velocity["heading"]),
+		VerticalRate: known(velocity["verticalRate"]),
+	}
+	f.ICAO24, _ = record["icao24"].(string)
+	f.Callsign, _ = record["callsign"].(string)
+	f.OriginCountry, _ = record["originCountry"].(string)
+	if timestamp, _ := record["timestamp"].(int64); timestamp != 0 {
+		f.LastContact = time.UnixMilli(timestamp)
+		f.LastUpdated = f.LastContact
+	}
+	if _, ok := record["lastContact"]; ok {
+		f.LastContact = fromMillis(record["lastContact"])
+		f.LastUpdated = fromMillis(record["lastUpdated"])
+	}
+	if t := fromMillis(record["timePosition"]); !t.IsZero() {
+		f.TimePosition = &t
+	}
+
+	var ok bool
+	f.OnGround, ok = unwrap(record["onGround"]).(bool)
+	f.OnGroundUnknown = !ok
+	f.SPI, ok = unwrap(record["spi"]).(bool)
+	f.SPIUnknown = !ok
+	f.Squawk, _ = unwrap(record["squawk"]).(string)
+	positionSource, _ := record["positionSource"].(int32)
+	category, _ := record["category"].(int32)
+	f.PositionSource, f.Category = int(positionSource), int(category)
+	if items, ok := unwrap(record["sensors"]).([]interface{}); ok {
+		f.Sensors = make([]int, 0, len(items))
+		for _, item := range items {
+			sensor, _ := item.(int32)
+			f.Sensors = append(f.Sensors, int(sensor))
+		}
+	}
+	return f
+}
+
+// unwrap returns the value of a decoded union, or v itself if it is not
+// one. A null union decodes to nil.
+func unwrap(v interface{}) interface{} {
+	if branch, ok := v.(map[string]interface{}); ok && len(branch) == 1 {
+		for _, value := range branch {
+			return value
+		}
+	}
+	return v
+}
+
+func double(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func millis(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+// fromMillis converts a decoded Unix time in milliseconds, returning the
+// zero time for null.
+func fromMillis(v interface{}) time.Time {
+	ms, ok := unwrap(v).(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// known returns a pointer to a decoded double, or nil if it is null or
+// NaN.
+func known(v interface{}) *float64 {
+	f, ok := unwrap(v).(float64)
+	if !ok || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/riferrei/srclient"
+)
+
+// Serialisation formats of flights on Kafka.
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// Codec serialises flights written to and read from Kafka.
+type Codec interface {
+	Encode(flight types.Flight) ([]byte, error)
+	Decode(data []byte) (types.Flight, error)
+}
+
+// NewCodec creates the codec for the format selected by cfg.KafkaFormat.
+// Avro schemas are taken from the registry at cfg.SchemaRegistryURL.
+func NewCodec(cfg *config.Config) (Codec, error) {
+	switch cfg.KafkaFormat {
+	case "", FormatJSON:
+		return JSONCodec{}, nil
+	case FormatAvro:
+		return NewAvroCodec(srclient.CreateSchemaRegistryClient(cfg.SchemaRegistryURL), FlightSubject)
+	default:
+		return nil, fmt.Errorf("unknown Kafka format %q", cfg.KafkaFormat)
+	}
+}
+
+// JSONCodec encodes flights as plain JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(flight types.Flight) ([]byte, error) {
+	return json.Marshal(flight)
+}
+
+func (JSONCodec) Decode(data []byte) (types.Flight, error) {
+	var flight types.Flight
+	err := json.Unmarshal(data, &flight)
+	return flight, err
+}
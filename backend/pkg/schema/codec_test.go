@@ -0,0 +1,235 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/riferrei/srclient"
+)
+
+// fakeRegistry serves schemas/flight-avro.avsc as the latest version of
+// FlightSubject under the given ID.
+func fakeRegistry(t *testing.T, id int) *httptest.Server {
+	return serveSchema(t, id, flightAvsc(t))
+}
+
+func flightAvsc(t *testing.T) string {
+	avsc, err := os.ReadFile("../../schemas/flight-avro.avsc")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	return string(avsc)
+}
+
+// serveSchema serves avsc as the latest version of FlightSubject under the
+// given ID.
+func serveSchema(t *testing.T, id int, avsc string) *httptest.Server {
+	return serveSchemas(t, map[int]string{id: avsc})
+}
+
+// serveSchemas serves each version of FlightSubject under its ID. IDs
+// must be consecutive, the highest being the latest version.
+func serveSchemas(t *testing.T, versions map[int]string) *httptest.Server {
+	mux := http.NewServeMux()
+	var latest []byte
+	for id, avsc := range versions {
+		response, _ := json.Marshal(map[string]interface{}{
+			"subject": FlightSubject,
+			"version": 1,
+			"id":      id,
+			"schema":  avsc,
+		})
+		mux.HandleFunc(fmt.Sprintf("/schemas/ids/%d", id), func(w http.ResponseWriter, r *http.Request) {
+			w.Write(response)
+		})
+		if _, ok := versions[id+1]; !ok {
+			latest = response
+		}
+	}
+	mux.HandleFunc("/subjects/"+FlightSubject+"/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(latest)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAvroCodecRoundTrip(t *testing.T) {
+	registry := fakeRegistry(t, 42)
+	codec, err := NewAvroCodec(srclient.CreateSchemaRegistryClient(registry.URL), FlightSubject)
+	if err != nil {
+		t.Fatalf("NewAvroCodec returned error: %v", err)
+	}
+
+	contact := time.UnixMilli(1700000000123)
+	timePosition := time.UnixMilli(1700000000045)
+	full := types.Flight{
+		ICAO24:         "3c6444",
+		Callsign:       "DLH4AB",
+		OriginCountry:  "Germany",
+		TimePosition:   &timePosition,
+		LastContact:    contact,
+		LastUpdated:    time.UnixMilli(1700000000456),
+		Latitude:       types.Float64(48.35),
+		Longitude:      types.Float64(11.78),
+		BaroAltitude:   types.Float64(10668),
+		GeoAltitude:    types.Float64(10972.8),
+		OnGround:       true,
+		Velocity:       types.Float64(231.5),
+		TrueTrack:      types.Float64(92.1),
+		VerticalRate:   types.Float64(-3.25),
+		Sensors:        []int{1, 7},
+		Squawk:         "7700",
+		SPI:            true,
+		PositionSource: 1,
+		Category:       4,
+	}
+	unknown := types.Flight{
+		ICAO24:          "3c6444",
+		Callsign:        "DLH4AB",
+		LastContact:     contact,
+		LastUpdated:     contact,
+		OnGroundUnknown: true,
+		SPIUnknown:      true,
+	}
+
+	for name, flight := range map[string]types.Flight{"every field": full, "unknown values": unknown} {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Encode(flight)
+			if err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if data[0] != 0 || data[1] != 0 || data[2] != 0 || data[3] != 0 || data[4] != 42 {
+				t.Fatalf("Expected magic byte and schema ID 42, got % x", data[:5])
+			}
+
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("Decode returned error: %v", err)
+			}
+			if !decoded.SameState(flight) || !decoded.LastUpdated.Equal(flight.LastUpdated) {
+				t.Errorf("Expected %+v to survive, got %+v", flight, decoded)
+			}
+			if decoded.OnGroundUnknown != flight.OnGroundUnknown || decoded.SPIUnknown != flight.SPIUnknown {
+				t.Errorf("Expected on-ground and SPI unknown to be %v and %v, got %v and %v",
+					flight.OnGroundUnknown, flight.SPIUnknown, decoded.OnGroundUnknown, decoded.SPIUnknown)
+			}
+		})
+	}
+}
+
+// flightAvscV1 is the first version of the schema, in which every field
+// was required and NaN stood for unknown values.
+const flightAvscV1 = `{
+  "type": "record",
+  "name": "FlightAvro",
+  "namespace": "com.realtimeDashboard.flight",
+  "fields": [
+    {"name": "timestamp", "type": "long"},
+    {"name": "icao24", "type": "string"},
+    {"name": "callsign", "type": "string"},
+    {"name": "position", "type": {"type": "record", "name": "Position", "fields": [
+      {"name": "latitude", "type": "double"},
+      {"name": "longitude", "type": "double"},
+      {"name": "altitude", "type": "double"}
+    ]}},
+    {"name": "velocity", "type": {"type": "record", "name": "Velocity", "fields": [
+      {"name": "speed", "type": "double"},
+      {"name": "heading", "type": "double"},
+      {"name": "verticalRate", "type": "double"}
+    ]}}
+  ]
+}`
+
+func TestAvroCodecDecodesFirstSchemaVersion(t *testing.T) {
+	registry := serveSchemas(t, map[int]string{1: flightAvscV1, 2: flightAvsc(t)})
+	client := srclient.CreateSchemaRegistryClient(registry.URL)
+	codec, err := NewAvroCodec(client, FlightSubject)
+	if err != nil {
+		t.Fatalf("NewAvroCodec returned error: %v", err)
+	}
+	if codec.SchemaID() != 2 {
+		t.Fatalf("Expected the latest schema 2, got %d", codec.SchemaID())
+	}
+	v1, err := client.GetSchema(1)
+	if err != nil {
+		t.Fatalf("GetSchema returned error: %v", err)
+	}
+
+	data, err := v1.Codec().BinaryFromNative([]byte{0, 0, 0, 0, 1}, map[string]interface{}{
+		"timestamp": int64(1700000000123),
+		"icao24":    "3c6444",
+		"callsign":  "DLH4AB",
+		"position":  map[string]interface{}{"latitude": 48.35, "longitude": 11.78, "altitude": 10668.0},
+		"velocity":  map[string]interface{}{"speed": 231.5, "heading": 92.1, "verticalRate": math.NaN()},
+	})
+	if err != nil {
+		t.Fatalf("BinaryFromNative returned error: %v", err)
+	}
+
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if decoded.ICAO24 != "3c6444" || !decoded.LastContact.Equal(time.UnixMilli(1700000000123)) {
+		t.Errorf("Expected identity and timestamp to survive, got %+v", decoded)
+	}
+	if decoded.BaroAltitude == nil || *decoded.BaroAltitude != 10668 || decoded.GeoAltitude != nil {
+		t.Errorf("Expected the altitude to decode as barometric only, got %v and %v", decoded.BaroAltitude, decoded.GeoAltitude)
+	}
+	if decoded.VerticalRate != nil {
+		t.Errorf("Expected NaN vertical rate to decode as unknown, got %v", *decoded.VerticalRate)
+	}
+	if !decoded.OnGroundUnknown || !decoded.SPIUnknown {
+		t.Errorf("Expected on-ground and SPI to be unknown, got %+v", decoded)
+	}
+}
+
+func TestAvroCodecDecodeErrors(t *testing.T) {
+	registry := fakeRegistry(t, 42)
+	codec, err := NewAvroCodec(srclient.CreateSchemaRegistryClient(registry.URL), FlightSubject)
+	if err != nil {
+		t.Fatalf("NewAvroCodec returned error: %v", err)
+	}
+
+	if _, err := codec.Decode([]byte(`{"icao24":"3c6444"}`)); !errors.Is(err, ErrNotAvro) {
+		t.Errorf("Expected ErrNotAvro for JSON, got %v", err)
+	}
+
+	data, _ := codec.Encode(types.Flight{ICAO24: "3c6444"})
+	data[4] = 7
+	if _, err := codec.Decode(data); err == nil {
+		t.Error("Expected an error for an unknown schema ID")
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	registry := fakeRegistry(t, 1)
+
+	codec, err := NewCodec(&config.Config{KafkaFormat: FormatJSON})
+	if _, ok := codec.(JSONCodec); err != nil || !ok {
+		t.Errorf("Expected JSONCodec, got %T (%v)", codec, err)
+	}
+
+	codec, err = NewCodec(&config.Config{KafkaFormat: FormatAvro, SchemaRegistryURL: registry.URL})
+	if _, ok := codec.(*AvroCodec); err != nil || !ok {
+		t.Errorf("Expected AvroCodec, got %T (%v)", codec, err)
+	}
+
+	if _, err := NewCodec(&config.Config{KafkaFormat: "protobuf"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -2,66 +2,248 @@ package schema
 
 import (
 	"encoding/json"
-	"os"
-	"github.com/real-time-dashboard/backend/pkg/log"
-
+	"fmt"
+	"math"
+	"strings"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/types"
 	"github.com/riferrei/srclient"
 )
 
-var (
-	schemaRegistryClient *srclient.SchemaRegistryClient
-	flightSchema         *srclient.Schema
-)
+// Validator checks flights against the latest registered schema of a
+// subject as well as with ValidateFlight. The fields a record must have and
+// their types are read from the schema, so a new version that adds a
+// required field or changes a type is enforced without a release. Fields
+// that are not nullable are required: a default only lets consumers read
+// records written before the field was added.
+type Validator struct {
+	schema *srclient.Schema
+	fields []avroField
+}
+
+// avroField is a field of an Avro record schema.
+type avroField map[string]json.RawMessage
 
-func InitSchemaRegistry() error {
-	schemaRegistryURL := os.Getenv("SCHEMA_REGISTRY_URL")
-	if schemaRegistryURL == "" {
-		schemaRegistryURL = "http://localhost:8081"
-		log.LogWarn("SCHEMA_REGISTRY_URL not set, using default: %s", schemaRegistryURL)
+// NewValidator loads the latest schema of subject from the registry.
+func NewValidator(registry *srclient.SchemaRegistryClient, subject string) (*Validator, error) {
+	schema, err := registry.GetLatestSchema(subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema %s: %w", subject, err)
+	}
+	fields, ok := recordFields(json.RawMessage(schema.Schema()))
+	if !ok {
+		return nil, fmt.Errorf("schema %s is not a record", subject)
 	}
+	return &Validator{schema: schema, fields: fields}, nil
+}
 
-	client := srclient.CreateSchemaRegistryClient(schemaRegistryURL)
-	schemaRegistryClient = client
+// NewFlightValidator creates the Validator for FlightSubject in the
+// registry at cfg.SchemaRegistryURL.
+func NewFlightValidator(cfg *config.Config) (*Validator, error) {
+	return NewValidator(srclient.CreateSchemaRegistryClient(cfg.SchemaRegistryURL), FlightSubject)
+}
 
-	// Get the latest schema for flights-value subject
-	schema, err := client.GetLatestSchema("flights-value")
-	if err != nil {
-		log.LogError("Failed to get schema from registry: %v", err)
-		return err
+// SchemaID returns the ID of the schema flights are validated against.
+func (v *Validator) SchemaID() int {
+	return v.schema.ID()
+}
+
+// Validate returns nil for a valid flight. The flight is checked as the
+// record it is encoded to, so fields are named as in the schema, such as
+// position.latitude. Unknown values, empty strings and NaN count as
+// missing. A nil Validator only applies ValidateFlight.
+func (v *Validator) Validate(f types.Flight) *RecordError {
+	e := ValidateFlight(f)
+	if v == nil {
+		return e
+	}
+	if e == nil {
+		e = &RecordError{ICAO24: f.ICAO24}
+	}
+
+	record := fitRecord(e, "", v.fields, toNative(f))
+	if len(e.Fields) == 0 {
+		// Catch whatever checkRecord cannot tell from the field types,
+		// such as enum symbols or named types.
+		if _, err := v.schema.Codec().BinaryFromNative(nil, record); err != nil {
+			e.add("record", "does not match schema %d: %v", v.schema.ID(), err)
+		}
+	}
+
+	if len(e.Fields) > 0 {
+		return e
 	}
-	flightSchema = schema
-	log.LogInfo("Schema loaded successfully, ID: %d", schema.ID())
 	return nil
 }
 
-func ValidateFlightData(data []byte) error {
-	// Parse JSON to validate structure
-	var flights []map[string]interface{}
-	if err := json.Unmarshal(data, &flights); err != nil {
-		return err
+// fitRecord shapes record, as returned by toNative, to the fields of a
+// schema: values of unions are wrapped in their branch and missing values
+// of nullable fields are set to null. If e is not nil, missing values of
+// other fields and values that do not match their types are reported to
+// it; otherwise they are left for the codec to reject.
+func fitRecord(e *RecordError, prefix string, fields []avroField, record map[string]interface{}) map[string]interface{} {
+	fitted := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		var name string
+		json.Unmarshal(field["name"], &name)
+		path := prefix + name
+
+		value, ok := record[name]
+		if nested, isRecord := recordFields(field["type"]); isRecord {
+			if value, ok := value.(map[string]interface{}); ok {
+				fitted[name] = fitRecord(e, path+".", nested, value)
+				continue
+			}
+		}
+		if missing(value) {
+			if nullable(field["type"]) {
+				fitted[name] = nil
+				continue
+			}
+			if e != nil {
+				e.add(path, "is required by the schema")
+			}
+			if ok {
+				fitted[name] = value
+			}
+			continue
+		}
+
+		if !matches(field["type"], value) {
+			if e != nil {
+				e.add(path, "must be %s", typeName(field["type"]))
+			}
+			fitted[name] = value
+			continue
+		}
+		fitted[name] = wrap(field["type"], value)
+	}
+	return fitted
+}
+
+// missing reports whether a value of a toNative record is unknown.
+func missing(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return math.IsNaN(v)
 	}
+	return false
+}
 
-	// Validate each flight record against schema
-	for _, flight := range flights {
-		if err := validateFlightRecord(flight); err != nil {
-			log.LogWarn("Flight record validation failed: %v", err)
-			return err
+// nullable reports whether schema is null or a union with a null branch.
+func nullable(schema json.RawMessage) bool {
+	var branches []json.RawMessage
+	if json.Unmarshal(schema, &branches) != nil {
+		return typeName(schema) == "null"
+	}
+	for _, branch := range branches {
+		if typeName(branch) == "null" {
+			return true
 		}
 	}
-	
-	log.LogDebug("Validated %d flight records", len(flights))
-	return nil
+	return false
 }
 
-func validateFlightRecord(flight map[string]interface{}) error {
-	// Basic field validation based on schema
-	requiredFields := []string{"icao24", "callsign", "origin_country", "longitude", "latitude", "on_ground", "velocity", "true_track", "vertical_rate", "geo_altitude"}
-	
-	for _, field := range requiredFields {
-		if _, exists := flight[field]; !exists {
-			log.LogError("Missing required field: %s", field)
-			return nil // Continue processing even with validation errors
+// wrap wraps value in the first branch of a union it matches, the way
+// goavro expects values of unions. Values of other types are returned
+// unchanged.
+func wrap(schema json.RawMessage, value interface{}) interface{} {
+	var branches []json.RawMessage
+	if json.Unmarshal(schema, &branches) != nil {
+		return value
+	}
+	for _, branch := range branches {
+		if typeName(branch) != "null" && matches(branch, value) {
+			return map[string]interface{}{typeName(branch): value}
 		}
 	}
-	return nil
-}
\ No newline at end of file
+	return value
+}
+
+// recordFields returns the fields of a record schema.
+func recordFields(schema json.RawMessage) ([]avroField, bool) {
+	var record struct {
+		Type   string      `json:"type"`
+		Fields []avroField `json:"fields"`
+	}
+	if json.Unmarshal(schema, &record) != nil || record.Type != "record" {
+		return nil, false
+	}
+	return record.Fields, true
+}
+
+// matches reports whether a plain value can be encoded as schema, a union
+// matching the values of any of its branches. Types other than primitives,
+// arrays, records and unions of them are assumed to match and left to the
+// codec.
+func matches(schema json.RawMessage, value interface{}) bool {
+	var branches []json.RawMessage
+	if json.Unmarshal(schema, &branches) == nil {
+		for _, branch := range branches {
+			if matches(branch, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch typeName(schema) {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "int", "long":
+		switch value.(type) {
+		case int, int32, int64:
+			return true
+		}
+		return false
+	case "float", "double":
+		switch value.(type) {
+		case float32, float64:
+			return true
+		}
+		return false
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "bytes":
+		_, ok := value.([]byte)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "record":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+// typeName describes a type for error messages: the name of a primitive
+// or complex type, or the branches of a union joined by "or".
+func typeName(schema json.RawMessage) string {
+	var union []json.RawMessage
+	if json.Unmarshal(schema, &union) == nil {
+		names := make([]string, len(union))
+		for i, branch := range union {
+			names[i] = typeName(branch)
+		}
+		return strings.Join(names, " or ")
+	}
+
+	var name string
+	if json.Unmarshal(schema, &name) == nil {
+		return name
+	}
+	var complex struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(schema, &complex)
+	return complex.Type
+}
@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Plausible ranges of the values of a flight. Altitudes are in metres,
+// from below the Dead Sea to above any airliner, and speeds in m/s.
+const (
+	MinAltitude     = -500.0
+	MaxAltitude     = 20000.0
+	MaxVelocity     = 600.0
+	MaxVerticalRate = 150.0
+)
+
+var icao24Pattern = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// FieldError describes why one field of a record is invalid.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// RecordError lists the invalid fields of one record. Index is the
+// position of the record in the batch it was validated in.
+type RecordError struct {
+	Index  int          `json:"index"`
+	ICAO24 string       `json:"icao24,omitempty"`
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *RecordError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		reasons[i] = field.Error()
+	}
+	return fmt.Sprintf("record %d (%s): %s", e.Index, e.ICAO24, strings.Join(reasons, "; "))
+}
+
+func (e *RecordError) add(field, reason string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(reason, args...)})
+}
+
+// ValidateFlight checks that a flight can be identified, has been seen
+// and reports plausible values. It returns nil for a valid flight.
+func ValidateFlight(f types.Flight) *RecordError {
+	e := &RecordError{ICAO24: f.ICAO24}
+	if !icao24Pattern.MatchString(f.ICAO24) {
+		e.add("icao24", "must be 6 hexadecimal digits, got %q", f.ICAO24)
+	}
+	if f.LastSeen().IsZero() {
+		e.add("last_contact", "is required")
+	}
+	if f.Latitude != nil {
+		checkRange(e, "latitude", *f.Latitude, -90, 90)
+	}
+	if f.Longitude != nil {
+		checkRange(e, "longitude", *f.Longitude, -180, 180)
+	}
+	if (f.Latitude == nil) != (f.Longitude == nil) {
+		e.add("position", "latitude and longitude must both be known or both be unknown")
+	}
+	if f.BaroAltitude != nil {
+		checkRange(e, "baro_altitude", *f.BaroAltitude, MinAltitude, MaxAltitude)
+	}
+	if f.GeoAltitude != nil {
+		checkRange(e, "geo_altitude", *f.GeoAltitude, MinAltitude, MaxAltitude)
+	}
+	if f.Velocity != nil {
+		checkRange(e, "velocity", *f.Velocity, 0, MaxVelocity)
+	}
+	if f.TrueTrack != nil {
+		checkRange(e, "true_track", *f.TrueTrack, 0, 360)
+	}
+	if f.VerticalRate != nil {
+		checkRange(e, "vertical_rate", *f.VerticalRate, -MaxVerticalRate, MaxVerticalRate)
+	}
+
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+}
+
+func checkRange(e *RecordError, field string, v, min, max float64) {
+	if math.IsNaN(v) || v < min || v > max {
+		e.add(field, "%g is outside [%g, %g]", v, min, max)
+	}
+}
@@ -0,0 +1,197 @@
+package schema
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/riferrei/srclient"
+)
+
+func validFlight() types.Flight {
+	return types.Flight{
+		ICAO24:        "3c6444",
+		Callsign:      "DLH4AB",
+		OriginCountry: "Germany",
+		Latitude:      types.Float64(48.35),
+		Longitude:     types.Float64(11.78),
+		BaroAltitude:  types.Float64(10668),
+		Velocity:      types.Float64(231.5),
+		TrueTrack:     types.Float64(92.1),
+		VerticalRate:  types.Float64(-2.3),
+		LastContact:   time.Unix(1700000000, 0),
+	}
+}
+
+func TestValidateFlight(t *testing.T) {
+	if err := ValidateFlight(validFlight()); err != nil {
+		t.Fatalf("Expected a valid flight, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(f *types.Flight)
+		field  string
+	}{
+		{"icao24 not hex", func(f *types.Flight) { f.ICAO24 = "3c644z" }, "icao24"},
+		{"icao24 too short", func(f *types.Flight) { f.ICAO24 = "3c644" }, "icao24"},
+		{"never seen", func(f *types.Flight) { f.LastContact = time.Time{} }, "last_contact"},
+		{"latitude", func(f *types.Flight) { f.Latitude = types.Float64(91) }, "latitude"},
+		{"longitude", func(f *types.Flight) { f.Longitude = types.Float64(-180.5) }, "longitude"},
+		{"half a position", func(f *types.Flight) { f.Longitude = nil }, "position"},
+		{"altitude", func(f *types.Flight) { f.BaroAltitude = types.Float64(30000) }, "baro_altitude"},
+		{"velocity", func(f *types.Flight) { f.Velocity = types.Float64(-1) }, "velocity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flight := validFlight()
+			tt.modify(&flight)
+			err := ValidateFlight(flight)
+			if err == nil {
+				t.Fatal("Expected a validation error")
+			}
+			if len(err.Fields) != 1 || err.Fields[0].Field != tt.field {
+				t.Errorf("Expected an error on %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestValidatorChecksRegisteredSchema(t *testing.T) {
+	validator, err := NewFlightValidator(&config.Config{SchemaRegistryURL: fakeRegistry(t, 42).URL})
+	if err != nil {
+		t.Fatalf("NewFlightValidator returned error: %v", err)
+	}
+	if validator.SchemaID() != 42 {
+		t.Errorf("Expected schema 42, got %d", validator.SchemaID())
+	}
+	if err := validator.Validate(validFlight()); err != nil {
+		t.Fatalf("Expected a valid flight, got %v", err)
+	}
+	unknown := validFlight()
+	unknown.Latitude, unknown.Longitude, unknown.Velocity = nil, nil, nil
+	if err := validator.Validate(unknown); err != nil {
+		t.Errorf("Expected unknown values to be valid, got %v", err)
+	}
+
+	for field, modify := range map[string]func(f *types.Flight){
+		"callsign":      func(f *types.Flight) { f.Callsign = "" },
+		"originCountry": func(f *types.Flight) { f.OriginCountry = "" },
+	} {
+		flight := validFlight()
+		modify(&flight)
+		if err := validator.Validate(flight); err == nil || len(err.Fields) != 1 || err.Fields[0].Field != field {
+			t.Errorf("Expected %s to be required, got %v", field, err)
+		}
+	}
+
+	invalid := validFlight()
+	invalid.ICAO24 = "3c644z"
+	if err := validator.Validate(invalid); err == nil || err.Fields[0].Field != "icao24" {
+		t.Errorf("Expected ValidateFlight to still apply, got %v", err)
+	}
+
+	var nilValidator *Validator
+	if err := nilValidator.Validate(invalid); err == nil || err.Fields[0].Field != "icao24" {
+		t.Errorf("Expected a nil Validator to apply ValidateFlight, got %v", err)
+	}
+}
+
+func TestValidatorFollowsNewSchemaVersions(t *testing.T) {
+	avsc := flightAvsc(t)
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		field  string
+		reason string
+	}{
+		{
+			"required field",
+			`{"name": "callsign", "type": "string"},`,
+			`{"name": "callsign", "type": "string"}, {"name": "registration", "type": "string"},`,
+			"registration", "is required by the schema",
+		},
+		{
+			"nested type",
+			`{"name": "altitude", "type": ["null", "double"], "default": null}`,
+			`{"name": "altitude", "type": ["null", "long"], "default": null}`,
+			"position.altitude", "must be null or long",
+		},
+		{
+			"union",
+			`{"name": "icao24", "type": "string"}`,
+			`{"name": "icao24", "type": ["null", "long"]}`,
+			"icao24", "must be null or long",
+		},
+		{
+			"left to the codec",
+			`{"name": "callsign", "type": "string"}`,
+			`{"name": "callsign", "type": {"type": "enum", "name": "Airline", "symbols": ["BAW"]}}`,
+			"record", "does not match schema 43",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(avsc, tt.from) {
+				t.Fatalf("Schema does not contain %s", tt.from)
+			}
+			registry := serveSchema(t, 43, strings.Replace(avsc, tt.from, tt.to, 1))
+			validator, err := NewValidator(srclient.CreateSchemaRegistryClient(registry.URL), FlightSubject)
+			if err != nil {
+				t.Fatalf("NewValidator returned error: %v", err)
+			}
+
+			invalid := validator.Validate(validFlight())
+			if invalid == nil {
+				t.Fatal("Expected a validation error")
+			}
+			if len(invalid.Fields) != 1 || invalid.Fields[0].Field != tt.field || !strings.HasPrefix(invalid.Fields[0].Reason, tt.reason) {
+				t.Errorf("Expected %s: %s, got %v", tt.field, tt.reason, invalid)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name     string
+		field    string
+		required bool
+	}{
+		{"nullable field", `{"name": "registration", "type": ["null", "string"], "default": null}`, false},
+		{"field with a default", `{"name": "registration", "type": "string", "default": ""}`, true},
+	} {
+		added := strings.Replace(avsc, `{"name": "callsign", "type": "string"},`, `{"name": "callsign", "type": "string"}, `+tt.field+`,`, 1)
+		validator, err := NewValidator(srclient.CreateSchemaRegistryClient(serveSchema(t, 44, added).URL), FlightSubject)
+		if err != nil {
+			t.Fatalf("NewValidator returned error: %v", err)
+		}
+		if err := validator.Validate(validFlight()); (err != nil) != tt.required {
+			t.Errorf("Expected a %s to be required: %v, got %v", tt.name, tt.required, err)
+		}
+	}
+}
+
+func TestValidatorTreatsNaNAsMissing(t *testing.T) {
+	// The first version of the schema had no nullable fields.
+	validator, err := NewValidator(srclient.CreateSchemaRegistryClient(serveSchema(t, 1, flightAvscV1).URL), FlightSubject)
+	if err != nil {
+		t.Fatalf("NewValidator returned error: %v", err)
+	}
+	if err := validator.Validate(validFlight()); err != nil {
+		t.Fatalf("Expected a valid flight, got %v", err)
+	}
+
+	for _, rate := range []*float64{types.Float64(math.NaN()), nil} {
+		flight := validFlight()
+		flight.VerticalRate = rate
+		err := validator.Validate(flight)
+		if err == nil {
+			t.Fatal("Expected a validation error")
+		}
+		if last := err.Fields[len(err.Fields)-1]; last.Field != "velocity.verticalRate" || last.Reason != "is required by the schema" {
+			t.Errorf("Expected velocity.verticalRate to be required, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package snapshot persists the tracked flights to a local file so that a
+// restarted service can serve them before its first fetch completes.
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Version is the format version written by this package. Snapshots with a
+// different version are rejected rather than misread.
+const Version = 1
+
+// Snapshot is the content of a snapshot file, stored as gzipped JSON.
+type Snapshot struct {
+	Version int            `json:"version"`
+	TakenAt time.Time      `json:"taken_at"`
+	Flights []types.Flight `json:"flights"`
+}
+
+// Write stores flights at path. The file is written next to its final
+// location and renamed into place, so a crash never leaves a partial
+// snapshot behind.
+func Write(path string, flights []types.Flight, takenAt time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(zw).Encode(Snapshot{Version: Version, TakenAt: takenAt, Flights: flights})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read loads the snapshot at path. A missing file is reported with an
+// error satisfying errors.Is(err, fs.ErrNotExist).
+func Read(path string) (Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	var s Snapshot
+	if err := json.NewDecoder(zr).Decode(&s); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if s.Version != Version {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, Version)
+	}
+	return s, nil
+}
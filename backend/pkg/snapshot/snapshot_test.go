@@ -0,0 +1,68 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flights.json.gz")
+	takenAt := time.Unix(1700000000, 0).UTC()
+	flights := []types.Flight{{
+		ICAO24:       "3c6444",
+		Callsign:     "DLH4AB",
+		Latitude:     types.Float64(48.35),
+		Longitude:    types.Float64(11.78),
+		LastContact:  takenAt,
+		FieldSources: map[string]string{"position": "opensky"},
+	}}
+
+	if err := Write(path, flights, takenAt); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	s, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+
+	if !s.TakenAt.Equal(takenAt) || len(s.Flights) != 1 {
+		t.Fatalf("Expected 1 flight taken at %v, got %+v", takenAt, s)
+	}
+
+	got := s.Flights[0]
+	if got.Callsign != "DLH4AB" || *got.Latitude != 48.35 || got.Velocity != nil || got.FieldSources["position"] != "opensky" {
+		t.Errorf("Expected flight to survive the round trip, got %+v", got)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	_, err := Read(filepath.Join(t.TempDir(), "missing.json.gz"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestReadRejectsOtherVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flights.json.gz")
+	f, _ := os.Create(path)
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(`{"version":99,"flights":[]}`))
+	zw.Close()
+	f.Close()
+
+	if _, err := Read(path); err == nil {
+		t.Error("Expected error for an unsupported version")
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// encodeHash flattens a flight into hash fields named after its JSON
+// fields, each holding the JSON encoding of its value. Unknown values are
+// left out rather than stored as null.
+func encodeHash(flight types.Flight) (map[string]interface{}, error) {
+	data, err := json.Marshal(flight)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	hash := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		if !bytes.Equal(value, []byte("null")) {
+			hash[name] = string(value)
+		}
+	}
+	return hash, nil
+}
+
+// decodeHash rebuilds a flight from the fields written by encodeHash.
+func decodeHash(hash map[string]string) (types.Flight, error) {
+	names := make([]string, 0, len(hash))
+	for name := range hash {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.WriteString(hash[name])
+	}
+	buf.WriteByte('}')
+
+	var flight types.Flight
+	err := json.Unmarshal(buf.Bytes(), &flight)
+	return flight, err
+}
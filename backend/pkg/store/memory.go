@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// gridCellDeg is the cell size of the spatial index in degrees.
+const gridCellDeg = 1.0
+
+// MemoryStore keeps flights in a map, with positions in a grid index.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	flights map[string]types.Flight
+	index   *geo.Grid
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		flights: make(map[string]types.Flight),
+		index:   geo.NewGrid(gridCellDeg),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, icao24 string) (types.Flight, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flight, ok := s.flights[icao24]
+	return flight, ok, nil
+}
+
+func (s *MemoryStore) GetMany(ctx context.Context, icao24s []string) (map[string]types.Flight, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := make(map[string]types.Flight, len(icao24s))
+	for _, icao24 := range icao24s {
+		if flight, ok := s.flights[icao24]; ok {
+			found[icao24] = flight
+		}
+	}
+	return found, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, flights []types.Flight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, flight := range flights {
+		s.flights[flight.ICAO24] = flight
+		if flight.HasPosition() {
+			s.index.Update(flight.ICAO24, *flight.Latitude, *flight.Longitude)
+		} else {
+			s.index.Remove(flight.ICAO24)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) All(ctx context.Context) ([]types.Flight, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flights := make([]types.Flight, 0, len(s.flights))
+	for _, flight := range s.flights {
+		flights = append(flights, flight)
+	}
+	return flights, nil
+}
+
+func (s *MemoryStore) InBBox(ctx context.Context, box geo.BBox) ([]types.Flight, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.index.InBBox(box)
+	flights := make([]types.Flight, 0, len(ids))
+	for _, icao24 := range ids {
+		flights = append(flights, s.flights[icao24])
+	}
+	return flights, nil
+}
+
+func (s *MemoryStore) Nearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]types.NearbyFlight, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := s.index.Nearby(lat, lon, radiusKm)
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	flights := make([]types.NearbyFlight, 0, len(found))
+	for _, n := range found {
+		flights = append(flights, types.NearbyFlight{Flight: s.flights[n.ID], DistanceKm: n.DistanceKm})
+	}
+	return flights, nil
+}
+
+func (s *MemoryStore) Evict(ctx context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var evicted []string
+	for icao24, flight := range s.flights {
+		if flight.LastSeen().Before(before) {
+			delete(s.flights, icao24)
+			s.index.Remove(icao24)
+			evicted = append(evicted, icao24)
+		}
+	}
+	return evicted, nil
+}
+
+func (s *MemoryStore) Len(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.flights), nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis geo sets cannot hold positions closer to the poles than this.
+const maxGeoLatitude = 85.05112878
+
+// Keys used by RedisStore. Each flight is a hash under flightPrefix+icao24
+// that expires FLIGHT_TTL after the aircraft was last seen. seenKey is a
+// sorted set of ICAO24s scored by last seen time in milliseconds and geoKey
+// is a geo set of their positions. polarKey is the set of flights whose
+// position is beyond maxGeoLatitude, which spatial queries check one by
+// one instead.
+const (
+	flightPrefix = "flight:"
+	seenKey      = "flights:seen"
+	geoKey       = "flights:geo"
+	polarKey     = "flights:polar"
+)
+
+// evictScript atomically removes the flights last seen before ARGV[1],
+// returning their ICAO24s.
+var evictScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('SREM', KEYS[3], id)
+	redis.call('DEL', ARGV[2] .. id)
+end
+return ids
+`)
+
+// RedisStore keeps flights in Redis so that every replica of the service
+// sees the same state.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore connects to Redis at addr, either host:port or a
+// redis:// URL. Flights expire ttl after they were last seen.
+func NewRedisStore(addr string, ttl time.Duration) (*RedisStore, error) {
+	opts := &redis.Options{Addr: addr}
+	if strings.Contains(addr, "://") {
+		var err error
+		if opts, err = redis.ParseURL(addr); err != nil {
+			return nil, fmt.Errorf("invalid Redis URL: %w", err)
+		}
+	}
+	return &RedisStore{client: redis.NewClient(opts), ttl: ttl}, nil
+}
+
+// Client returns the underlying Redis client.
+func (s *RedisStore) Client() *redis.Client {
+	return s.client
+}
+
+// Ping checks that Redis is reachable.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *RedisStore) Get(ctx context.Context, icao24 string) (types.Flight, bool, error) {
+	hash, err := s.client.HGetAll(ctx, flightPrefix+icao24).Result()
+	if err != nil || len(hash) == 0 {
+		return types.Flight{}, false, err
+	}
+	flight, err := decodeHash(hash)
+	return flight, err == nil, err
+}
+
+func (s *RedisStore) GetMany(ctx context.Context, icao24s []string) (map[string]types.Flight, error) {
+	found := make(map[string]types.Flight, len(icao24s))
+	if len(icao24s) == 0 {
+		return found, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(icao24s))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, icao24 := range icao24s {
+			cmds[i] = pipe.HGetAll(ctx, flightPrefix+icao24)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		hash := cmd.Val()
+		if len(hash) == 0 {
+			continue
+		}
+		flight, err := decodeHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode flight %s: %w", icao24s[i], err)
+		}
+		found[icao24s[i]] = flight
+	}
+	return found, nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, flights []types.Flight) error {
+	if len(flights) == 0 {
+		return nil
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, flight := range flights {
+			hash, err := encodeHash(flight)
+			if err != nil {
+				return err
+			}
+			key := flightPrefix + flight.ICAO24
+			seen := flight.LastSeen()
+
+			// Replace the hash so that fields which became unknown are dropped.
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key, hash)
+			pipe.PExpireAt(ctx, key, seen.Add(s.ttl))
+			pipe.ZAdd(ctx, seenKey, redis.Z{Score: float64(seen.UnixMilli()), Member: flight.ICAO24})
+
+			switch {
+			case !flight.HasPosition():
+				pipe.ZRem(ctx, geoKey, flight.ICAO24)
+				pipe.SRem(ctx, polarKey, flight.ICAO24)
+			case math.Abs(*flight.Latitude) > maxGeoLatitude:
+				pipe.ZRem(ctx, geoKey, flight.ICAO24)
+				pipe.SAdd(ctx, polarKey, flight.ICAO24)
+			default:
+				pipe.GeoAdd(ctx, geoKey, &redis.GeoLocation{
+					Name:      flight.ICAO24,
+					Longitude: *flight.Longitude,
+					Latitude:  *flight.Latitude,
+				})
+				pipe.SRem(ctx, polarKey, flight.ICAO24)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) All(ctx context.Context) ([]types.Flight, error) {
+	ids, err := s.client.ZRange(ctx, seenKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.getList(ctx, ids)
+}
+
+// getList returns the flights among ids, in the same order, skipping those
+// that have expired.
+func (s *RedisStore) getList(ctx context.Context, ids []string) ([]types.Flight, error) {
+	found, err := s.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	flights := make([]types.Flight, 0, len(found))
+	for _, icao24 := range ids {
+		if flight, ok := found[icao24]; ok {
+			flights = append(flights, flight)
+		}
+	}
+	return flights, nil
+}
+
+func (s *RedisStore) InBBox(ctx context.Context, box geo.BBox) ([]types.Flight, error) {
+	// Search the circle around the box, then keep what is inside it.
+	lat, lon := (box.MinLat+box.MaxLat)/2, (box.MinLon+box.MaxLon)/2
+	ids, err := s.candidates(ctx, lat, lon, boundingRadiusKm(box, lat, lon))
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.getList(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	flights := candidates[:0]
+	for _, flight := range candidates {
+		if flight.HasPosition() && box.Contains(*flight.Latitude, *flight.Longitude) {
+			flights = append(flights, flight)
+		}
+	}
+	return flights, nil
+}
+
+// candidates returns the ICAO24s of the flights that may lie within
+// radiusKm of a position: those found in the geo set, and every flight too
+// close to a pole to be in it. A centre beyond the range of the geo set is
+// moved onto its edge, with the radius widened to cover the original
+// circle.
+func (s *RedisStore) candidates(ctx context.Context, lat, lon, radiusKm float64) ([]string, error) {
+	centre := math.Max(-maxGeoLatitude, math.Min(maxGeoLatitude, lat))
+	locations, err := s.client.GeoRadius(ctx, geoKey, lon, centre, &redis.GeoRadiusQuery{
+		Radius: radiusKm + geo.Distance(lat, lon, centre, lon),
+		Unit:   "km",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	polar, err := s.client.SMembers(ctx, polarKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(locations)+len(polar))
+	for _, location := range locations {
+		ids = append(ids, location.Name)
+	}
+	return append(ids, polar...), nil
+}
+
+// boundingRadiusKm returns a radius around the centre of the box that
+// covers the whole box, measured to points along its edges.
+func boundingRadiusKm(box geo.BBox, lat, lon float64) float64 {
+	const steps = 16
+	var radius float64
+	for i := 0; i <= steps; i++ {
+		f := float64(i) / steps
+		edgeLat := box.MinLat + f*(box.MaxLat-box.MinLat)
+		edgeLon := box.MinLon + f*(box.MaxLon-box.MinLon)
+		for _, d := range []float64{
+			geo.Distance(lat, lon, edgeLat, box.MinLon),
+			geo.Distance(lat, lon, edgeLat, box.MaxLon),
+			geo.Distance(lat, lon, box.MinLat, edgeLon),
+			geo.Distance(lat, lon, box.MaxLat, edgeLon),
+		} {
+			radius = math.Max(radius, d)
+		}
+	}
+	// Allow for the points between samples and the rounding of Redis.
+	return radius*1.05 + 1
+}
+
+func (s *RedisStore) Nearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]types.NearbyFlight, error) {
+	ids, err := s.candidates(ctx, lat, lon, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.getList(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redis uses a slightly different Earth radius, so distances are
+	// recomputed to match the in-memory store.
+	flights := make([]types.NearbyFlight, 0, len(candidates))
+	for _, flight := range candidates {
+		if !flight.HasPosition() {
+			continue
+		}
+		d := geo.Distance(lat, lon, *flight.Latitude, *flight.Longitude)
+		if d <= radiusKm {
+			flights = append(flights, types.NearbyFlight{Flight: flight, DistanceKm: d})
+		}
+	}
+	sort.Slice(flights, func(i, j int) bool {
+		if flights[i].DistanceKm != flights[j].DistanceKm {
+			return flights[i].DistanceKm < flights[j].DistanceKm
+		}
+		return flights[i].ICAO24 < flights[j].ICAO24
+	})
+	if limit > 0 && len(flights) > limit {
+		flights = flights[:limit]
+	}
+	return flights, nil
+}
+
+func (s *RedisStore) Evict(ctx context.Context, before time.Time) ([]string, error) {
+	cutoff := strconv.FormatInt(before.UnixMilli(), 10)
+	return evictScript.Run(ctx, s.client, []string{seenKey, geoKey, polarKey}, cutoff, flightPrefix).StringSlice()
+}
+
+// Len counts the flights whose hashes have not expired yet, i.e. those last
+// seen within the TTL by the clock of Redis, even if they have not been
+// evicted.
+func (s *RedisStore) Len(ctx context.Context) (int, error) {
+	now, err := s.client.Time(ctx).Result()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := "(" + strconv.FormatInt(now.Add(-s.ttl).UnixMilli(), 10)
+	n, err := s.client.ZCount(ctx, seenKey, cutoff, "+inf").Result()
+	return int(n), err
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+func newTestRedisStore(t *testing.T, ttl time.Duration) (*RedisStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	s, err := NewRedisStore(mr.Addr(), ttl)
+	if err != nil {
+		t.Fatalf("NewRedisStore returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, mr
+}
+
+func TestRedisStore(t *testing.T) {
+	s, mr := newTestRedisStore(t, time.Hour)
+	// Redis stores last seen times to the millisecond.
+	now := time.Now().Truncate(time.Millisecond)
+	mr.SetTime(now)
+	testStore(t, s, now)
+}
+
+func TestRedisStoreUsesHashes(t *testing.T) {
+	s, mr := newTestRedisStore(t, time.Hour)
+	err := s.Put(context.Background(), []types.Flight{{
+		ICAO24:      "3c6444",
+		Callsign:    "DLH4AB",
+		Latitude:    types.Float64(48.35),
+		Longitude:   types.Float64(11.78),
+		LastContact: time.Now(),
+	}})
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	if got := mr.HGet("flight:3c6444", "callsign"); got != `"DLH4AB"` {
+		t.Errorf("Expected callsign field in the hash, got %q", got)
+	}
+	if mr.Exists("flight:3c6444") && mr.HGet("flight:3c6444", "velocity") != "" {
+		t.Error("Expected unknown fields to be left out of the hash")
+	}
+
+	if members, _ := mr.ZMembers("flights:geo"); len(members) != 1 {
+		t.Errorf("Expected the position in the geo set, got %v", members)
+	}
+}
+
+func TestRedisStoreExpiresFlights(t *testing.T) {
+	s, mr := newTestRedisStore(t, 5*time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+	mr.SetTime(now)
+
+	s.Put(ctx, []types.Flight{{ICAO24: "3c6444", LastContact: now.Add(-time.Minute)}})
+	mr.FastForward(5 * time.Minute)
+	mr.SetTime(now.Add(5 * time.Minute))
+
+	if _, ok, _ := s.Get(ctx, "3c6444"); ok {
+		t.Error("Expected the flight to expire FLIGHT_TTL after it was last seen")
+	}
+	if all, _ := s.All(ctx); len(all) != 0 {
+		t.Errorf("Expected expired flights to be skipped, got %d", len(all))
+	}
+	if n, err := s.Len(ctx); err != nil || n != 0 {
+		t.Errorf("Expected expired flights not to be counted, got %d, %v", n, err)
+	}
+
+	evicted, err := s.Evict(ctx, now)
+	if err != nil || len(evicted) != 1 {
+		t.Errorf("Expected eviction to clean up the expired flight, got %v, %v", evicted, err)
+	}
+}
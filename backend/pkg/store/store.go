@@ -0,0 +1,49 @@
+// Package store holds the current state of the tracked flights, either in
+// process memory or in Redis where it is shared by every replica.
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// Store is the current state of the tracked flights, keyed by ICAO24.
+// Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns a single flight and whether it is tracked.
+	Get(ctx context.Context, icao24 string) (types.Flight, bool, error)
+	// GetMany returns the tracked flights among icao24s.
+	GetMany(ctx context.Context, icao24s []string) (map[string]types.Flight, error)
+	// Put inserts or replaces flights.
+	Put(ctx context.Context, flights []types.Flight) error
+	// All returns every tracked flight, in no particular order.
+	All(ctx context.Context) ([]types.Flight, error)
+	// InBBox returns the flights positioned inside the box.
+	InBBox(ctx context.Context, box geo.BBox) ([]types.Flight, error)
+	// Nearby returns at most limit flights within radiusKm of the given
+	// position, nearest first.
+	Nearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]types.NearbyFlight, error)
+	// Evict removes the flights last seen before the given time and
+	// returns their ICAO24s.
+	Evict(ctx context.Context, before time.Time) ([]string, error)
+	// Len returns the number of tracked flights.
+	Len(ctx context.Context) (int, error)
+	Close() error
+}
+
+// New creates the store selected by STORE: "memory" (the default) or
+// "redis", which expires flights after FLIGHT_TTL.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		return NewRedisStore(cfg.RedisURL, cfg.FlightTTL)
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/types"
+)
+
+// testStore runs the behaviour every Store implementation must share.
+func testStore(t *testing.T, s Store, now time.Time) {
+	ctx := context.Background()
+	err := s.Put(ctx, []types.Flight{
+		{ICAO24: "400001", Callsign: "BAW1", Latitude: types.Float64(51.4700), Longitude: types.Float64(-0.4543), BaroAltitude: types.Float64(1200), LastContact: now},
+		{ICAO24: "400002", Latitude: types.Float64(51.1537), Longitude: types.Float64(-0.1821), LastContact: now.Add(-time.Minute)},
+		{ICAO24: "39c001", Latitude: types.Float64(49.0097), Longitude: types.Float64(2.5479), LastContact: now.Add(-10 * time.Minute)},
+		{ICAO24: "a00001", OnGround: true, LastContact: now},
+	})
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	flight, ok, err := s.Get(ctx, "400001")
+	if err != nil || !ok {
+		t.Fatalf("Expected 400001 to be stored, got %v, %v", ok, err)
+	}
+	if flight.Callsign != "BAW1" || *flight.BaroAltitude != 1200 || flight.Velocity != nil || !flight.LastContact.Equal(now) {
+		t.Errorf("Expected stored flight to round trip, got %+v", flight)
+	}
+
+	if _, ok, _ := s.Get(ctx, "ffffff"); ok {
+		t.Error("Expected unknown flight not to be found")
+	}
+
+	many, err := s.GetMany(ctx, []string{"400002", "ffffff", "a00001"})
+	if err != nil || len(many) != 2 {
+		t.Errorf("Expected 2 of 3 flights, got %v, %v", many, err)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil || len(all) != 4 {
+		t.Errorf("Expected 4 flights, got %d, %v", len(all), err)
+	}
+
+	inBox, err := s.InBBox(ctx, geo.BBox{MinLat: 50, MinLon: -1, MaxLat: 52, MaxLon: 0})
+	if ids := flightIDs(inBox); err != nil || len(ids) != 2 || ids[0] != "400001" || ids[1] != "400002" {
+		t.Errorf("Expected London flights in the box, got %v, %v", ids, err)
+	}
+
+	nearby, err := s.Nearby(ctx, 51.5074, -0.1278, 500, 2)
+	if err != nil || len(nearby) != 2 || nearby[0].ICAO24 != "400001" || nearby[1].ICAO24 != "400002" {
+		t.Fatalf("Expected 400001 then 400002, got %+v, %v", nearby, err)
+	}
+	if nearby[0].DistanceKm < 20 || nearby[0].DistanceKm > 30 {
+		t.Errorf("Expected about 24 km to 400001, got %v", nearby[0].DistanceKm)
+	}
+
+	// Losing its position takes a flight out of spatial queries.
+	if err := s.Put(ctx, []types.Flight{{ICAO24: "400002", LastContact: now}}); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if nearby, _ := s.Nearby(ctx, 51.5074, -0.1278, 100, 0); len(nearby) != 1 {
+		t.Errorf("Expected only 400001 nearby, got %+v", nearby)
+	}
+	if flight, _, _ := s.Get(ctx, "400002"); flight.Latitude != nil {
+		t.Errorf("Expected the old position to be dropped, got %v", *flight.Latitude)
+	}
+
+	evicted, err := s.Evict(ctx, now.Add(-5*time.Minute))
+	if err != nil || len(evicted) != 1 || evicted[0] != "39c001" {
+		t.Errorf("Expected 39c001 to be evicted, got %v, %v", evicted, err)
+	}
+	if n, err := s.Len(ctx); err != nil || n != 3 {
+		t.Errorf("Expected 3 flights after eviction, got %d, %v", n, err)
+	}
+	if nearby, _ := s.Nearby(ctx, 49.0097, 2.5479, 10, 0); len(nearby) != 0 {
+		t.Errorf("Expected evicted flight to leave spatial queries, got %+v", nearby)
+	}
+
+	// Positions closer to the poles than Redis geo sets allow are found too.
+	err = s.Put(ctx, []types.Flight{{ICAO24: "4b1801", Latitude: types.Float64(88.5), Longitude: types.Float64(15), LastContact: now}})
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	inBox, err = s.InBBox(ctx, geo.BBox{MinLat: 86, MinLon: 0, MaxLat: 90, MaxLon: 30})
+	if ids := flightIDs(inBox); err != nil || len(ids) != 1 || ids[0] != "4b1801" {
+		t.Errorf("Expected the polar flight in the box, got %v, %v", ids, err)
+	}
+	if nearby, err := s.Nearby(ctx, 89.9, 0, 300, 0); err != nil || len(nearby) != 1 || nearby[0].ICAO24 != "4b1801" {
+		t.Errorf("Expected the polar flight near the pole, got %+v, %v", nearby, err)
+	}
+	if nearby, _ := s.Nearby(ctx, 51.5074, -0.1278, 100, 0); len(nearby) != 1 {
+		t.Errorf("Expected the polar flight to stay out of distant searches, got %+v", nearby)
+	}
+}
+
+func flightIDs(flights []types.Flight) []string {
+	ids := make([]string, len(flights))
+	for i, f := range flights {
+		ids[i] = f.ICAO24
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(), time.Now())
+}
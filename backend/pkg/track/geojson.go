@@ -0,0 +1,44 @@
+package track
+
+import (
+	"time"
+)
+
+// Feature is a GeoJSON Feature (RFC 7946) holding a trail as a LineString.
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   LineString             `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// LineString is a GeoJSON LineString geometry. Each position is
+// [longitude, latitude] with the altitude in metres appended when known.
+type LineString struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
+}
+
+// NewFeature builds a GeoJSON feature from a trail. The report time of each
+// position is kept in the "times" property, index for index.
+func NewFeature(points []Point, properties map[string]interface{}) Feature {
+	coordinates := make([][]float64, 0, len(points))
+	times := make([]time.Time, 0, len(points))
+	for _, p := range points {
+		position := []float64{p.Longitude, p.Latitude}
+		if p.Altitude != nil {
+			position = append(position, *p.Altitude)
+		}
+		coordinates = append(coordinates, position)
+		times = append(times, p.Time)
+	}
+
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+	properties["times"] = times
+	return Feature{
+		Type:       "Feature",
+		Geometry:   LineString{Type: "LineString", Coordinates: coordinates},
+		Properties: properties,
+	}
+}
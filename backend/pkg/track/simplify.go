@@ -0,0 +1,77 @@
+package track
+
+import (
+	"math"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+)
+
+// kmPerDegree is the length of one degree of latitude.
+const kmPerDegree = geo.EarthRadiusKm * math.Pi / 180
+
+// Simplify reduces a trail with the Douglas-Peucker algorithm, dropping
+// points that lie within toleranceKm of the line through their neighbours.
+// The first and last points are always kept.
+func Simplify(points []Point, toleranceKm float64) []Point {
+	if len(points) < 3 || toleranceKm <= 0 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Walk the segments with an explicit stack so long trails cannot
+	// exhaust the goroutine stack.
+	type segment struct{ first, last int }
+	stack := []segment{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		farthest, maxDist := -1, toleranceKm
+		for i := s.first + 1; i < s.last; i++ {
+			if d := crossTrackKm(points[i], points[s.first], points[s.last]); d > maxDist {
+				farthest, maxDist = i, d
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, segment{s.first, farthest}, segment{farthest, s.last})
+		}
+	}
+
+	simplified := make([]Point, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// crossTrackKm returns the distance of p from the segment a-b, projecting
+// the points onto a plane around a. Trails are short enough for the error
+// of the projection to be negligible.
+func crossTrackKm(p, a, b Point) float64 {
+	scale := math.Cos(a.Latitude * math.Pi / 180)
+	project := func(q Point) (x, y float64) {
+		dLon := q.Longitude - a.Longitude
+		if dLon > 180 {
+			dLon -= 360
+		} else if dLon < -180 {
+			dLon += 360
+		}
+		return dLon * scale * kmPerDegree, (q.Latitude - a.Latitude) * kmPerDegree
+	}
+
+	px, py := project(p)
+	bx, by := project(b)
+	lengthSq := bx*bx + by*by
+	if lengthSq == 0 {
+		return math.Hypot(px, py)
+	}
+
+	// Clamp to the segment so points beyond its ends are measured to the
+	// nearest endpoint.
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/lengthSq))
+	return math.Hypot(px-t*bx, py-t*by)
+}
@@ -0,0 +1,69 @@
+// Package track keeps the recent positions of an aircraft and simplifies
+// them into trails for display.
+package track
+
+import (
+	"time"
+)
+
+// Point is a single reported position.
+type Point struct {
+	Time      time.Time `json:"time"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  *float64  `json:"altitude"`
+}
+
+// Ring is a bounded buffer of the most recent positions of an aircraft,
+// oldest first. It is not safe for concurrent use.
+type Ring struct {
+	points []Point
+	start  int
+	size   int
+}
+
+// NewRing creates a buffer that keeps at most capacity points.
+func NewRing(capacity int) *Ring {
+	return &Ring{points: make([]Point, capacity)}
+}
+
+// Len returns the number of buffered points.
+func (r *Ring) Len() int {
+	return r.size
+}
+
+// Add appends p, dropping the oldest point when the buffer is full. Points
+// that repeat the last position, or are older than it, are ignored.
+func (r *Ring) Add(p Point) bool {
+	if len(r.points) == 0 {
+		return false
+	}
+	if r.size > 0 {
+		last := r.points[(r.start+r.size-1)%len(r.points)]
+		if !p.Time.After(last.Time) || (p.Latitude == last.Latitude && p.Longitude == last.Longitude) {
+			return false
+		}
+	}
+
+	if r.size < len(r.points) {
+		r.points[(r.start+r.size)%len(r.points)] = p
+		r.size++
+	} else {
+		r.points[r.start] = p
+		r.start = (r.start + 1) % len(r.points)
+	}
+	return true
+}
+
+// Since returns a copy of the points reported at or after t, oldest first.
+// A zero t returns every point.
+func (r *Ring) Since(t time.Time) []Point {
+	points := make([]Point, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		p := r.points[(r.start+i)%len(r.points)]
+		if !p.Time.Before(t) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
@@ -0,0 +1,91 @@
+package track
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRingKeepsMostRecent(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	r := NewRing(3)
+	for i := 0; i < 5; i++ {
+		r.Add(Point{Time: start.Add(time.Duration(i) * time.Second), Latitude: float64(i), Longitude: float64(i)})
+	}
+
+	points := r.Since(time.Time{})
+	if len(points) != 3 || r.Len() != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(points))
+	}
+	for i, p := range points {
+		if p.Latitude != float64(i+2) {
+			t.Errorf("Expected point %d at latitude %d, got %v", i, i+2, p.Latitude)
+		}
+	}
+
+	if since := r.Since(start.Add(4 * time.Second)); len(since) != 1 || since[0].Latitude != 4 {
+		t.Errorf("Expected only the latest point, got %+v", since)
+	}
+}
+
+func TestRingIgnoresRepeatsAndOutOfOrder(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	r := NewRing(10)
+	r.Add(Point{Time: start, Latitude: 1, Longitude: 1})
+
+	if r.Add(Point{Time: start.Add(time.Second), Latitude: 1, Longitude: 1}) {
+		t.Error("Expected an unchanged position to be ignored")
+	}
+
+	if r.Add(Point{Time: start.Add(-time.Second), Latitude: 2, Longitude: 2}) {
+		t.Error("Expected an older position to be ignored")
+	}
+
+	if !r.Add(Point{Time: start.Add(time.Second), Latitude: 2, Longitude: 2}) || r.Len() != 2 {
+		t.Errorf("Expected a new position to be added, got %d points", r.Len())
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// A straight eastbound leg with a small wobble, then a turn north.
+	points := []Point{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0.001, Longitude: 0.5},
+		{Latitude: 0, Longitude: 1},
+		{Latitude: -0.001, Longitude: 1.5},
+		{Latitude: 0, Longitude: 2},
+		{Latitude: 1, Longitude: 2},
+	}
+
+	simplified := Simplify(points, 1)
+	if len(simplified) != 3 {
+		t.Fatalf("Expected the wobble to be removed, got %+v", simplified)
+	}
+	if simplified[1].Longitude != 2 || simplified[1].Latitude != 0 {
+		t.Errorf("Expected the turn to be kept, got %+v", simplified[1])
+	}
+
+	// Only the point exactly on the line is dropped at a tight tolerance.
+	if kept := Simplify(points, 0.01); len(kept) != len(points)-1 {
+		t.Errorf("Expected a tight tolerance to keep the wobble, got %d points", len(kept))
+	}
+}
+
+func TestNewFeature(t *testing.T) {
+	altitude := 3000.0
+	points := []Point{
+		{Time: time.Unix(1700000000, 0).UTC(), Latitude: 48.35, Longitude: 11.78},
+		{Time: time.Unix(1700000010, 0).UTC(), Latitude: 48.40, Longitude: 11.70, Altitude: &altitude},
+	}
+
+	data, err := json.Marshal(NewFeature(points, map[string]interface{}{"icao24": "3c6444"}))
+	if err != nil {
+		t.Fatalf("Failed to marshal feature: %v", err)
+	}
+
+	want := `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[11.78,48.35],[11.7,48.4,3000]]},` +
+		`"properties":{"icao24":"3c6444","times":["2023-11-14T22:13:20Z","2023-11-14T22:13:30Z"]}}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
@@ -2,18 +2,195 @@ package types
 
 import "time"
 
+// Position sources reported in an OpenSky state vector.
+const (
+	PositionSourceADSB    = 0
+	PositionSourceASTERIX = 1
+	PositionSourceMLAT    = 2
+	PositionSourceFLARM   = 3
+)
+
+// Flight is the current state of a single aircraft. Fields the upstream
+// may not know are pointers and are serialised as null when unknown, so
+// that consumers can tell a missing value apart from a genuine zero.
+// Callsign and Squawk are empty when unknown.
 type Flight struct {
-	ICAO24        string    `json:"icao24"`
-	Callsign      string    `json:"callsign"`
-	OriginCountry string    `json:"origin_country"`
-	Longitude     float64   `json:"longitude"`
-	Latitude      float64   `json:"latitude"`
-	OnGround      bool      `json:"on_ground"`
-	Velocity      float64   `json:"velocity"`
-	TrueTrack     float64   `json:"true_track"`
-	VerticalRate  float64   `json:"vertical_rate"`
-	GeoAltitude   float64   `json:"geo_altitude"`
-	LastUpdated   time.Time `json:"last_updated"`
+	ICAO24         string     `json:"icao24"`
+	Callsign       string     `json:"callsign"`
+	OriginCountry  string     `json:"origin_country"`
+	TimePosition   *time.Time `json:"time_position"`
+	LastContact    time.Time  `json:"last_contact"`
+	Longitude      *float64   `json:"longitude"`
+	Latitude       *float64   `json:"latitude"`
+	BaroAltitude   *float64   `json:"baro_altitude"`
+	OnGround       bool       `json:"on_ground"`
+	Velocity       *float64   `json:"velocity"`
+	TrueTrack      *float64   `json:"true_track"`
+	VerticalRate   *float64   `json:"vertical_rate"`
+	Sensors        []int      `json:"sensors,omitempty"`
+	GeoAltitude    *float64   `json:"geo_altitude"`
+	Squawk         string     `json:"squawk"`
+	SPI            bool       `json:"spi"`
+	PositionSource int        `json:"position_source"`
+	Category       int        `json:"category"`
+	LastUpdated    time.Time  `json:"last_updated"`
+
+	// Sources lists the feeds that contributed to this state and
+	// FieldSources names the feed each field was last taken from.
+	Sources      []string          `json:"sources,omitempty"`
+	FieldSources map[string]string `json:"field_sources,omitempty"`
+
+	// OnGroundUnknown and SPIUnknown are set by sources that did not
+	// report the flag, which is then false without meaning it. They only
+	// matter when merging updates and are not serialised.
+	OnGroundUnknown bool `json:"-"`
+	SPIUnknown      bool `json:"-"`
+}
+
+// HasPosition reports whether both coordinates of the flight are known.
+func (f Flight) HasPosition() bool {
+	return f.Latitude != nil && f.Longitude != nil
+}
+
+// Altitude returns the best known altitude of the flight, preferring the
+// barometric altitude over the geometric one.
+func (f Flight) Altitude() (float64, bool) {
+	if f.BaroAltitude != nil {
+		return *f.BaroAltitude, true
+	}
+	if f.GeoAltitude != nil {
+		return *f.GeoAltitude, true
+	}
+	return 0, false
+}
+
+// LastSeen returns the time of the last message from the aircraft, falling
+// back to when the record was last updated for sources without last contact.
+func (f Flight) LastSeen() time.Time {
+	if f.LastContact.IsZero() {
+		return f.LastUpdated
+	}
+	return f.LastContact
+}
+
+// SameState reports whether f and other describe the same state of the
+// aircraft. LastUpdated and the attribution of fields to sources are
+// ignored, since they change whenever a record is refetched.
+func (f Flight) SameState(other Flight) bool {
+	return f.ICAO24 == other.ICAO24 &&
+		f.Callsign == other.Callsign &&
+		f.OriginCountry == other.OriginCountry &&
+		equalTime(f.TimePosition, other.TimePosition) &&
+		f.LastContact.Equal(other.LastContact) &&
+		equalFloat(f.Longitude, other.Longitude) &&
+		equalFloat(f.Latitude, other.Latitude) &&
+		equalFloat(f.BaroAltitude, other.BaroAltitude) &&
+		f.OnGround == other.OnGround &&
+		equalFloat(f.Velocity, other.Velocity) &&
+		equalFloat(f.TrueTrack, other.TrueTrack) &&
+		equalFloat(f.VerticalRate, other.VerticalRate) &&
+		equalInts(f.Sensors, other.Sensors) &&
+		equalFloat(f.GeoAltitude, other.GeoAltitude) &&
+		f.Squawk == other.Squawk &&
+		f.SPI == other.SPI &&
+		f.PositionSource == other.PositionSource &&
+		f.Category == other.Category
+}
+
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Flight phases derived from the reported state of an aircraft.
+const (
+	PhaseUnknown = "unknown"
+	PhaseGround  = "ground"
+	PhaseClimb   = "climb"
+	PhaseCruise  = "cruise"
+	PhaseDescent = "descent"
+)
+
+// levelVerticalRate is the vertical rate in m/s (about 300 ft/min) below
+// which an airborne aircraft is considered to be flying level.
+const levelVerticalRate = 1.5
+
+// Phase derives the phase of flight from the ground flag and vertical rate.
+func (f Flight) Phase() string {
+	switch {
+	case f.OnGround:
+		return PhaseGround
+	case f.VerticalRate == nil:
+		return PhaseUnknown
+	case *f.VerticalRate >= levelVerticalRate:
+		return PhaseClimb
+	case *f.VerticalRate <= -levelVerticalRate:
+		return PhaseDescent
+	default:
+		return PhaseCruise
+	}
+}
+
+// FlightDetail is the state of a single aircraft together with values
+// derived from it at the time of the request.
+type FlightDetail struct {
+	Flight
+	SecondsSinceContact float64 `json:"seconds_since_contact"`
+	Phase               string  `json:"phase"`
+}
+
+// NewFlightDetail derives the detail view of f as of now. The time since
+// contact counts from LastSeen, since sources without a contact time only
+// set LastUpdated.
+func NewFlightDetail(f Flight, now time.Time) FlightDetail {
+	return FlightDetail{
+		Flight:              f,
+		SecondsSinceContact: now.Sub(f.LastSeen()).Seconds(),
+		Phase:               f.Phase(),
+	}
+}
+
+// NearbyFlight is a flight found by a radius search, with its great-circle
+// distance from the searched position.
+type NearbyFlight struct {
+	Flight
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Kinds of FlightEvent.
+const (
+	FlightUpdated = "updated"
+	FlightRemoved = "removed"
+)
+
+// FlightEvent is a change to the set of tracked flights that is published
+// to downstream consumers. Flight is only set for updates.
+type FlightEvent struct {
+	Type   string  `json:"type"`
+	ICAO24 string  `json:"icao24"`
+	Flight *Flight `json:"flight,omitempty"`
+	Reason string  `json:"reason,omitempty"`
 }
 
 type FlightStats struct {
@@ -21,4 +198,14 @@ type FlightStats struct {
 	InAir        int       `json:"in_air"`
 	OnGround     int       `json:"on_ground"`
 	LastUpdated  time.Time `json:"last_updated"`
-}
\ No newline at end of file
+}
+
+// Float64 returns a pointer to v, for populating the nullable fields of a Flight.
+func Float64(v float64) *float64 {
+	return &v
+}
+
+// Time returns a pointer to t, for populating the nullable fields of a Flight.
+func Time(t time.Time) *time.Time {
+	return &t
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -11,10 +12,10 @@ func TestFlightStruct(t *testing.T) {
 		ICAO24:        "abc123",
 		Callsign:      "TEST123",
 		OriginCountry: "United States",
-		Longitude:     -122.4194,
-		Latitude:      37.7749,
+		Longitude:     Float64(-122.4194),
+		Latitude:      Float64(37.7749),
 		OnGround:      false,
-		Velocity:      250.5,
+		Velocity:      Float64(250.5),
 		LastUpdated:   now,
 	}
 	
@@ -26,8 +27,47 @@ func TestFlightStruct(t *testing.T) {
 		t.Errorf("Expected OnGround false, got %t", flight.OnGround)
 	}
 	
-	if flight.Velocity != 250.5 {
-		t.Errorf("Expected Velocity 250.5, got %f", flight.Velocity)
+	if flight.Velocity == nil || *flight.Velocity != 250.5 {
+		t.Errorf("Expected Velocity 250.5, got %v", flight.Velocity)
+	}
+	
+	if !flight.HasPosition() {
+		t.Error("Expected flight to have a position")
+	}
+}
+
+func TestFlightUnknownFieldsMarshalAsNull(t *testing.T) {
+	flight := Flight{ICAO24: "abc123", Latitude: Float64(0)}
+	
+	data, err := json.Marshal(flight)
+	if err != nil {
+		t.Fatalf("Failed to marshal flight: %v", err)
+	}
+	
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal flight: %v", err)
+	}
+	
+	if decoded["longitude"] != nil {
+		t.Errorf("Expected unknown longitude to be null, got %v", decoded["longitude"])
+	}
+	
+	if decoded["latitude"] != 0.0 {
+		t.Errorf("Expected known latitude 0 to be kept, got %v", decoded["latitude"])
+	}
+	
+	if flight.HasPosition() {
+		t.Error("Expected flight without longitude to have no position")
+	}
+	
+	var roundTrip Flight
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Failed to unmarshal flight: %v", err)
+	}
+	
+	if roundTrip.Velocity != nil || roundTrip.Latitude == nil {
+		t.Error("Expected nullability to survive a JSON round trip")
 	}
 }
 
@@ -47,4 +87,82 @@ func TestFlightStats(t *testing.T) {
 	if stats.InAir+stats.OnGround != stats.TotalFlights {
 		t.Errorf("InAir + OnGround should equal TotalFlights")
 	}
-}
\ No newline at end of file
+}
+func TestFlightPhase(t *testing.T) {
+	tests := []struct {
+		name   string
+		flight Flight
+		want   string
+	}{
+		{"on ground", Flight{OnGround: true, VerticalRate: Float64(5)}, PhaseGround},
+		{"no vertical rate", Flight{}, PhaseUnknown},
+		{"climbing", Flight{VerticalRate: Float64(8.5)}, PhaseClimb},
+		{"level", Flight{VerticalRate: Float64(-0.3)}, PhaseCruise},
+		{"descending", Flight{VerticalRate: Float64(-4)}, PhaseDescent},
+	}
+	
+	for _, tt := range tests {
+		if got := tt.flight.Phase(); got != tt.want {
+			t.Errorf("%s: expected phase %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNewFlightDetail(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	
+	detail := NewFlightDetail(Flight{ICAO24: "3c6444", LastContact: now.Add(-12 * time.Second), VerticalRate: Float64(8.5)}, now)
+	if detail.SecondsSinceContact != 12 || detail.Phase != PhaseClimb {
+		t.Errorf("Expected 12s since contact while climbing, got %v and %s", detail.SecondsSinceContact, detail.Phase)
+	}
+	
+	// Records from the http and mock sources carry no contact time.
+	detail = NewFlightDetail(Flight{ICAO24: "3c6444", LastUpdated: now.Add(-3 * time.Second)}, now)
+	if detail.SecondsSinceContact != 3 {
+		t.Errorf("Expected the time since the last update without a contact time, got %v", detail.SecondsSinceContact)
+	}
+}
+
+func TestFlightSameState(t *testing.T) {
+	contact := time.Unix(1700000000, 0)
+	flight := Flight{
+		ICAO24:       "3c6444",
+		Callsign:     "DLH4AB",
+		Latitude:     Float64(48.35),
+		Longitude:    Float64(11.78),
+		TimePosition: Time(contact),
+		LastContact:  contact,
+		Sensors:      []int{1, 2},
+		LastUpdated:  contact,
+	}
+
+	// Values decoded from storage are distinct pointers in another location.
+	refetched := flight
+	refetched.Latitude = Float64(48.35)
+	refetched.TimePosition = Time(contact.UTC())
+	refetched.LastContact = contact.UTC()
+	refetched.Sensors = []int{1, 2}
+	refetched.LastUpdated = contact.Add(15 * time.Second)
+	refetched.Sources = []string{"opensky"}
+	if !flight.SameState(refetched) {
+		t.Error("Expected a refetched record to have the same state")
+	}
+
+	moved := refetched
+	moved.Latitude = Float64(48.36)
+	if flight.SameState(moved) {
+		t.Error("Expected a new position to change the state")
+	}
+
+	known := refetched
+	known.Velocity = Float64(0)
+	if flight.SameState(known) {
+		t.Error("Expected a newly known velocity to change the state")
+	}
+
+	heard := refetched
+	heard.LastContact = contact.Add(time.Second)
+	if flight.SameState(heard) {
+		t.Error("Expected a new contact to change the state")
+	}
+}
@@ -2,57 +2,262 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/real-time-dashboard/backend/pkg/config"
 	"github.com/real-time-dashboard/backend/pkg/types"
 	"github.com/real-time-dashboard/backend/pkg/client"
+	"github.com/real-time-dashboard/backend/pkg/events"
+	"github.com/real-time-dashboard/backend/pkg/fusion"
 	"github.com/real-time-dashboard/backend/pkg/health"
+	"github.com/real-time-dashboard/backend/pkg/leader"
 	"github.com/real-time-dashboard/backend/pkg/log"
 	"github.com/real-time-dashboard/backend/pkg/middleware"
 	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/query"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/snapshot"
+	"github.com/real-time-dashboard/backend/pkg/store"
+	"github.com/real-time-dashboard/backend/pkg/track"
+)
+
+// Redis key of the leader lock and channel the leader publishes updates on.
+const (
+	leaderKey      = "flight-data-service:leader"
+	updatesChannel = "flights:updates"
+)
+
+// Defaults and limits of GET /flights/nearby.
+const (
+	defaultNearbyRadiusKm = 50.0
+	maxNearbyRadiusKm     = 1000.0
+	defaultNearbyLimit    = 20
 )
 
 type FlightService struct {
-	flights map[string]types.Flight
+	flights store.Store
+	tracks  map[string]*track.Ring
 	mu      sync.RWMutex
-	fetcher *client.FlightFetcher
+	sources []client.Source
+	merger  *fusion.Merger
+	events  events.Publisher
 	config  *config.Config
 }
 
-func NewFlightService(cfg *config.Config) *FlightService {
+// NewFlightService creates a service fed by sources, listed from most to
+// least trusted.
+func NewFlightService(cfg *config.Config, sources ...client.Source) *FlightService {
+	priority := make([]string, 0, len(sources))
+	for _, source := range sources {
+		priority = append(priority, source.Name())
+	}
+	
 	fs := &FlightService{
-		flights: make(map[string]types.Flight),
-		fetcher: client.NewFlightFetcher(),
+		flights: store.NewMemoryStore(),
+		tracks:  make(map[string]*track.Ring),
+		sources: sources,
+		merger:  fusion.NewMerger(priority),
+		events:  events.NopPublisher{},
 		config:  cfg,
 	}
-	go fs.startFetching()
 	return fs
 }
 
+// GetAllFlights returns a page of the flights matching the query filters
+// in a stable order, of query.DefaultLimit flights unless limit is set.
+// When more flights remain, the cursor of the next page is returned in the
+// X-Next-Cursor header.
 func (fs *FlightService) GetAllFlights(c *gin.Context) {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
+	filter, err := query.ParseFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := query.ParseSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := query.ParseLimit(c.Query("limit"), query.DefaultLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var candidates []types.Flight
+	if filter.BBox != nil {
+		candidates, err = fs.flights.InBBox(c.Request.Context(), *filter.BBox)
+	} else {
+		candidates, err = fs.flights.All(c.Request.Context())
+	}
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	
+	flights := candidates[:0]
+	for _, flight := range candidates {
+		if filter.Match(flight) {
+			flights = append(flights, flight)
+		}
+	}
+	
+	total := len(flights)
+	page, next, err := query.Paginate(flights, order, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
+	c.JSON(200, page)
+}
+
+// GetNearbyFlights returns the flights within radius_km of lat/lon, nearest
+// first.
+func (fs *FlightService) GetNearbyFlights(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon must be valid coordinates"})
+		return
+	}
 	
-	flights := make([]types.Flight, 0, len(fs.flights))
-	for _, flight := range fs.flights {
-		flights = append(flights, flight)
+	radius := defaultNearbyRadiusKm
+	if s := c.Query("radius_km"); s != "" {
+		var err error
+		radius, err = strconv.ParseFloat(s, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadiusKm {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius_km must be between 0 and %g", maxNearbyRadiusKm)})
+			return
+		}
+	}
+	
+	limit, err := query.ParseLimit(c.Query("limit"), defaultNearbyLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	flights, err := fs.flights.Nearby(c.Request.Context(), lat, lon, radius, limit)
+	if err != nil {
+		storeError(c, err)
+		return
 	}
 	c.JSON(200, flights)
 }
 
-func (fs *FlightService) GetStats(c *gin.Context) {
+// GetFlight returns the current state of a single aircraft with its
+// derived fields, or 404 when the aircraft is not being tracked.
+func (fs *FlightService) GetFlight(c *gin.Context) {
+	icao24 := strings.ToLower(c.Param("icao24"))
+	
+	flight, ok, err := fs.flights.Get(c.Request.Context(), icao24)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "flight not found", "icao24": icao24})
+		return
+	}
+	c.JSON(200, types.NewFlightDetail(flight, time.Now()))
+}
+
+// storeError reports a failure of the flight store to the client.
+func storeError(c *gin.Context, err error) {
+	log.LogError("Flight store request failed: %v", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "flight store unavailable"})
+}
+
+// GetTrack returns the recent positions of a single aircraft, optionally
+// simplified to tolerance_m metres, as a list of points or, with
+// format=geojson, as a GeoJSON LineString feature.
+func (fs *FlightService) GetTrack(c *gin.Context) {
+	icao24 := strings.ToLower(c.Param("icao24"))
+	
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		var err error
+		if since, err = query.ParseTime(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
+	var tolerance float64
+	if s := c.Query("tolerance_m"); s != "" {
+		var err error
+		if tolerance, err = strconv.ParseFloat(s, 64); err != nil || tolerance < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid tolerance_m %q", s)})
+			return
+		}
+	}
+	
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "geojson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+		return
+	}
+	
+	flight, ok, err := fs.flights.Get(c.Request.Context(), icao24)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	
+	var points []track.Point
 	fs.mu.RLock()
-	defer fs.mu.RUnlock()
+	if ring := fs.tracks[icao24]; ring != nil {
+		points = ring.Since(since)
+	}
+	fs.mu.RUnlock()
+	
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "flight not found", "icao24": icao24})
+		return
+	}
+	if points == nil {
+		points = []track.Point{}
+	}
+	points = track.Simplify(points, tolerance/1000)
+	
+	if format == "geojson" {
+		c.Header("Content-Type", "application/geo+json")
+		c.JSON(200, track.NewFeature(points, map[string]interface{}{
+			"icao24":   icao24,
+			"callsign": flight.Callsign,
+		}))
+		return
+	}
+	c.JSON(200, gin.H{"icao24": icao24, "callsign": flight.Callsign, "points": points})
+}
+
+func (fs *FlightService) GetStats(c *gin.Context) {
+	flights, err := fs.flights.All(c.Request.Context())
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	
-	totalFlights := len(fs.flights)
+	totalFlights := len(flights)
 	inAir := 0
 	onGround := 0
 	
-	for _, flight := range fs.flights {
+	for _, flight := range flights {
 		if flight.OnGround {
 			onGround++
 		} else {
@@ -69,30 +274,546 @@ func (fs *FlightService) GetStats(c *gin.Context) {
 	c.JSON(200, stats)
 }
 
-func (fs *FlightService) startFetching() {
-	ticker := time.NewTicker(fs.config.FetchInterval)
-	defer ticker.Stop()
+// run feeds the flight map from every source until ctx is cancelled.
+func (fs *FlightService) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, source := range fs.sources {
+		wg.Add(1)
+		go func(source client.Source) {
+			defer wg.Done()
+			if live, ok := source.(client.LiveSource); ok {
+				fs.runLive(ctx, live)
+				return
+			}
+			fs.startFetching(ctx, source)
+		}(source)
+	}
+	wg.Wait()
+}
+
+// applyFlights merges a batch of updates from source into the flight store
+// and publishes the flights whose state changed.
+func (fs *FlightService) applyFlights(ctx context.Context, source string, flights []types.Flight) error {
+	changed, err := fs.mergeFlights(ctx, source, flights)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
 	
-	for range ticker.C {
-		flights, err := fs.fetcher.FetchFlights()
-		if err != nil {
-			log.LogError("Failed to fetch flights: %v", err)
+	updates := make([]types.FlightEvent, 0, len(changed))
+	for i := range changed {
+		updates = append(updates, types.FlightEvent{Type: types.FlightUpdated, ICAO24: changed[i].ICAO24, Flight: &changed[i]})
+	}
+	if err := fs.events.Publish(ctx, updates); err != nil {
+		log.LogError("Failed to publish %d updates: %v", len(updates), err)
+	}
+	return nil
+}
+
+// mergeFlights folds flights into their stored state, writes the merged
+// records back and returns those that differ from the stored state.
+func (fs *FlightService) mergeFlights(ctx context.Context, source string, flights []types.Flight) ([]types.Flight, error) {
+	ids := make([]string, 0, len(flights))
+	for _, flight := range flights {
+		ids = append(ids, flight.ICAO24)
+	}
+	
+	// Merges read and write back the current state, so they are serialised.
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	
+	current, err := fs.flights.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]types.Flight, 0, len(flights))
+	var changed []types.Flight
+	for _, flight := range flights {
+		existing, exists := current[flight.ICAO24]
+		m := fs.merger.Merge(existing, exists, source, flight)
+		current[flight.ICAO24] = m
+		merged = append(merged, m)
+		if !exists || !m.SameState(existing) {
+			changed = append(changed, m)
+		}
+	}
+	if err := fs.flights.Put(ctx, merged); err != nil {
+		return nil, err
+	}
+	
+	for _, flight := range merged {
+		fs.recordPosition(flight)
+	}
+	fs.updateLiveGauge(ctx)
+	observability.FlightDataUpdates.Add(float64(len(flights)))
+	return changed, nil
+}
+
+// followEvents applies the events published by the leader to the state
+// this replica keeps for itself, such as tracks. The flights themselves
+// are already in the shared store.
+func (fs *FlightService) followEvents(ctx context.Context, events []types.FlightEvent) {
+	fs.mu.Lock()
+	for _, event := range events {
+		switch {
+		case event.Type == types.FlightUpdated && event.Flight != nil:
+			fs.recordPosition(*event.Flight)
+		case event.Type == types.FlightRemoved:
+			delete(fs.tracks, event.ICAO24)
+		}
+	}
+	fs.mu.Unlock()
+	fs.updateLiveGauge(ctx)
+}
+
+// lead runs the work only the leader does: fetching from every source and
+// evicting stale aircraft.
+func (fs *FlightService) lead(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fs.startEviction(ctx)
+	}()
+	fs.run(ctx)
+	wg.Wait()
+}
+
+// updateLiveGauge exports the number of tracked flights.
+func (fs *FlightService) updateLiveGauge(ctx context.Context) {
+	if n, err := fs.flights.Len(ctx); err == nil {
+		observability.LiveAircraft.Set(float64(n))
+	}
+}
+
+// recordPosition appends the position of flight to its track. The caller
+// must hold fs.mu.
+func (fs *FlightService) recordPosition(flight types.Flight) {
+	if !flight.HasPosition() || fs.config.TrackLength <= 0 {
+		return
+	}
+	ring, ok := fs.tracks[flight.ICAO24]
+	if !ok {
+		ring = track.NewRing(fs.config.TrackLength)
+		fs.tracks[flight.ICAO24] = ring
+	}
+	
+	at := flight.LastSeen()
+	if flight.TimePosition != nil {
+		at = *flight.TimePosition
+	}
+	altitude, ok := flight.Altitude()
+	point := track.Point{Time: at, Latitude: *flight.Latitude, Longitude: *flight.Longitude}
+	if ok {
+		point.Altitude = &altitude
+	}
+	ring.Add(point)
+}
+
+// restoreSnapshot loads the flights saved by a previous run, skipping
+// those not heard from within FLIGHT_TTL.
+func (fs *FlightService) restoreSnapshot(ctx context.Context, now time.Time) {
+	s, err := snapshot.Read(fs.config.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.LogInfo("No snapshot found at %s, starting empty", fs.config.SnapshotPath)
+		return
+	}
+	if err != nil {
+		log.LogError("Failed to restore snapshot from %s: %v", fs.config.SnapshotPath, err)
+		return
+	}
+	
+	cutoff := now.Add(-fs.config.FlightTTL)
+	ids := make([]string, 0, len(s.Flights))
+	for _, flight := range s.Flights {
+		ids = append(ids, flight.ICAO24)
+	}
+	
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	
+	// A shared store may already hold fresher state written by another
+	// replica, which is kept.
+	existing, err := fs.flights.GetMany(ctx, ids)
+	if err != nil {
+		log.LogError("Failed to restore snapshot: %v", err)
+		return
+	}
+	var restored []types.Flight
+	for _, flight := range s.Flights {
+		if _, exists := existing[flight.ICAO24]; exists || flight.LastSeen().Before(cutoff) {
 			continue
 		}
-		
-		fs.mu.Lock()
-		for _, flight := range flights {
-			fs.flights[flight.ICAO24] = flight
+		restored = append(restored, flight)
+	}
+	if err := fs.flights.Put(ctx, restored); err != nil {
+		log.LogError("Failed to restore snapshot: %v", err)
+		return
+	}
+	for _, flight := range restored {
+		fs.recordPosition(flight)
+	}
+	fs.updateLiveGauge(ctx)
+	
+	log.LogInfo("Restored %d of %d flights from snapshot taken at %v", len(restored), len(s.Flights), s.TakenAt)
+}
+
+// startSnapshots saves the flight map every SNAPSHOT_INTERVAL, and once
+// more when ctx is cancelled.
+func (fs *FlightService) startSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(fs.config.SnapshotInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			fs.saveSnapshot(context.Background(), time.Now())
+			return
+		case now := <-ticker.C:
+			fs.saveSnapshot(ctx, now)
 		}
+	}
+}
+
+// saveSnapshot writes the current flight map to SNAPSHOT_PATH.
+func (fs *FlightService) saveSnapshot(ctx context.Context, now time.Time) error {
+	flights, err := fs.flights.All(ctx)
+	if err != nil {
+		log.LogError("Failed to read flights for snapshot: %v", err)
+		return err
+	}
+	
+	if err := snapshot.Write(fs.config.SnapshotPath, flights, now); err != nil {
+		log.LogError("Failed to save snapshot to %s: %v", fs.config.SnapshotPath, err)
+		return err
+	}
+	log.LogDebug("Saved %d flights to %s", len(flights), fs.config.SnapshotPath)
+	return nil
+}
+
+// startEviction periodically drops aircraft that have not been heard from
+// for longer than FLIGHT_TTL.
+func (fs *FlightService) startEviction(ctx context.Context) {
+	ticker := time.NewTicker(fs.config.EvictionInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fs.evictStale(ctx, now)
+		}
+	}
+}
+
+// evictStale removes every aircraft whose last contact is older than
+// FLIGHT_TTL and publishes a removal event for each of them.
+func (fs *FlightService) evictStale(ctx context.Context, now time.Time) []string {
+	cutoff := now.Add(-fs.config.FlightTTL)
+	
+	fs.mu.Lock()
+	evicted, err := fs.flights.Evict(ctx, cutoff)
+	if err != nil {
 		fs.mu.Unlock()
+		log.LogError("Failed to evict stale aircraft: %v", err)
+		return nil
+	}
+	for _, icao24 := range evicted {
+		delete(fs.tracks, icao24)
+		fs.merger.Forget(icao24)
+	}
+	fs.mu.Unlock()
+	fs.updateLiveGauge(ctx)
+	
+	if len(evicted) == 0 {
+		return nil
+	}
+	observability.EvictedAircraft.Add(float64(len(evicted)))
+	log.LogInfo("Evicted %d aircraft not seen for %v", len(evicted), fs.config.FlightTTL)
+	
+	removals := make([]types.FlightEvent, 0, len(evicted))
+	for _, icao24 := range evicted {
+		removals = append(removals, types.FlightEvent{Type: types.FlightRemoved, ICAO24: icao24, Reason: "expired"})
+	}
+	if err := fs.events.Publish(ctx, removals); err != nil {
+		log.LogError("Failed to publish %d removals: %v", len(removals), err)
+	}
+	return evicted
+}
+
+// runLive applies updates from a live source as they arrive.
+func (fs *FlightService) runLive(ctx context.Context, live client.LiveSource) {
+	log.LogInfo("Streaming live updates from %s", live.Name())
+	live.Run(ctx, func(flight types.Flight) {
+		if err := fs.applyFlights(ctx, live.Name(), []types.Flight{flight}); err != nil {
+			log.LogError("Failed to apply update from %s: %v", live.Name(), err)
+		}
+	})
+}
+
+// startFetching polls the source, starting immediately, until ctx is
+// cancelled, which also aborts a fetch that is in flight.
+func (fs *FlightService) startFetching(ctx context.Context, source client.Source) {
+	p := &poller{
+		source:   source,
+		interval: fs.config.FetchInterval,
+		backoff:  client.NewBackoff(fs.config.FetchInterval, fs.config.FetchMaxBackoff),
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		
+		applied, err := fs.fetch(ctx, source)
+		if ctx.Err() != nil {
+			log.LogInfo("Stopped fetching flights from %s", source.Name())
+			return
+		}
+		var applyErr *applyError
+		if err != nil && !errors.As(err, &applyErr) {
+			timer.Reset(p.retryDelay(err))
+			continue
+		}
+		p.failures = 0
 		
-		log.LogInfo("Updated %d flights", len(flights))
+		if applyErr != nil {
+			log.LogError("Failed to store flights from %s after applying %d: %v", source.Name(), applied, applyErr.err)
+		} else {
+			log.LogInfo("Updated %d flights from %s", applied, source.Name())
+		}
+		timer.Reset(p.nextPoll())
 	}
 }
 
+// streamBatchSize is the number of flights applied at a time while a
+// source is streaming its response.
+const streamBatchSize = 500
+
+// applyError is a failure to apply fetched flights, which unlike a failed
+// fetch is not retried with backoff.
+type applyError struct {
+	err error
+}
+
+func (e *applyError) Error() string {
+	return e.err.Error()
+}
+
+// fetch polls source once and returns the number of flights applied.
+// Sources that stream are applied in batches of streamBatchSize while the
+// response is decoded, so a large response is never held in full.
+func (fs *FlightService) fetch(ctx context.Context, source client.Source) (int, error) {
+	streamer, ok := source.(client.Streamer)
+	if !ok {
+		flights, err := source.FetchFlights(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if err := fs.applyFlights(ctx, source.Name(), flights); err != nil {
+			return 0, &applyError{err}
+		}
+		return len(flights), nil
+	}
+	
+	applied := 0
+	batch := make([]types.Flight, 0, streamBatchSize)
+	apply := func() error {
+		if err := fs.applyFlights(ctx, source.Name(), batch); err != nil {
+			return &applyError{err}
+		}
+		applied += len(batch)
+		batch = make([]types.Flight, 0, streamBatchSize)
+		return nil
+	}
+	err := streamer.StreamFlights(ctx, func(flight types.Flight) error {
+		batch = append(batch, flight)
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+		return apply()
+	})
+	if err == nil && len(batch) > 0 {
+		err = apply()
+	}
+	return applied, err
+}
+
+// poller holds the retry state of a single polled source.
+type poller struct {
+	source   client.Source
+	interval time.Duration
+	backoff  *client.Backoff
+	failures int
+}
+
+// retryDelay backs off exponentially after consecutive failures, waiting
+// at least as long as the upstream asked for.
+func (p *poller) retryDelay(err error) time.Duration {
+	p.failures++
+	delay := p.backoff.Delay(p.failures)
+	
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	if poll := p.nextPoll(); poll > delay {
+		delay = poll
+	}
+	
+	if errors.Is(err, client.ErrCircuitOpen) {
+		log.LogDebug("Skipping fetch from %s: %v", p.source.Name(), err)
+	} else {
+		observability.FlightFetchErrors.WithLabelValues(p.source.Name()).Inc()
+		log.LogError("Failed to fetch flights from %s (attempt %d), retrying in %v: %v", p.source.Name(), p.failures, delay, err)
+	}
+	return delay
+}
+
+// nextPoll returns the delay before the next fetch, letting the source
+// stretch FETCH_INTERVAL when it is running low on upstream credits.
+func (p *poller) nextPoll() time.Duration {
+	advisor, ok := p.source.(client.PollAdvisor)
+	if !ok {
+		return p.interval
+	}
+	
+	delay := advisor.NextPoll(p.interval)
+	if delay > p.interval {
+		log.LogWarn("Delaying next fetch from %s by %v", p.source.Name(), delay)
+	}
+	return delay
+}
+
+// newBreakerSource wraps source in a circuit breaker whose state is
+// exported to Prometheus and /health.
+func newBreakerSource(cfg *config.Config, source client.Source) *client.BreakerSource {
+	gauge := observability.FlightSourceCircuitState.WithLabelValues(source.Name())
+	breaker := client.NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerOpenTimeout, func(state client.BreakerState) {
+		gauge.Set(float64(state))
+		log.LogWarn("Circuit breaker for %s is now %s", source.Name(), state)
+	})
+	gauge.Set(float64(client.BreakerClosed))
+	
+	health.RegisterCheck(source.Name()+"-circuit", func() (string, bool) {
+		state := breaker.State()
+		return state.String(), state == client.BreakerClosed
+	})
+	return client.NewBreakerSource(source, breaker)
+}
+
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	
 	cfg := config.Load()
-	flightService := NewFlightService(cfg)
+	sources, err := client.NewSources(cfg)
+	if err != nil {
+		log.LogFatal("Failed to create flight sources: %v", err)
+	}
+	// Live sources reconnect on their own; only polled sources get a breaker.
+	for i, source := range sources {
+		if _, live := source.(client.LiveSource); !live {
+			sources[i] = newBreakerSource(cfg, source)
+		}
+	}
+	flightStore, err := store.New(cfg)
+	if err != nil {
+		log.LogFatal("Failed to create flight store: %v", err)
+	}
+	defer flightStore.Close()
+	if redisStore, ok := flightStore.(*store.RedisStore); ok {
+		health.RegisterCheck("redis", func() (string, bool) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := redisStore.Ping(ctx); err != nil {
+				return err.Error(), false
+			}
+			return "connected", true
+		})
+	}
+	
+	flightService := NewFlightService(cfg, sources...)
+	flightService.flights = flightStore
+	if cfg.SnapshotPath != "" {
+		flightService.restoreSnapshot(ctx, time.Now())
+	}
+	if cfg.KafkaPublish {
+		codec, err := schema.NewCodec(cfg)
+		if err != nil {
+			log.LogFatal("Failed to create %s codec: %v", cfg.KafkaFormat, err)
+		}
+		validator, err := schema.NewFlightValidator(cfg)
+		if err != nil {
+			log.LogWarn("Validating flights without the registered schema: %v", err)
+		} else {
+			log.LogInfo("Validating flights against schema %d", validator.SchemaID())
+		}
+		var deadLetter events.DeadLetter
+		if cfg.KafkaDeadLetterTopic != "" {
+			deadLetter = events.NewKafkaDeadLetter(cfg.KafkaBroker, cfg.KafkaDeadLetterTopic)
+		}
+		publisher := events.Validating(events.NewKafkaPublisher(cfg.KafkaBroker, cfg.KafkaTopic, codec, cfg.KafkaBatchSize, cfg.KafkaBatchTimeout), validator, deadLetter)
+		defer publisher.Close()
+		flightService.events = publisher
+	}
+	if cfg.LeaderElection {
+		redisStore, ok := flightStore.(*store.RedisStore)
+		if !ok {
+			log.LogFatal("LEADER_ELECTION requires STORE=redis")
+		}
+		hostname, _ := os.Hostname()
+		id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		elector := leader.NewElector(redisStore.Client(), leaderKey, id, cfg.LeaderLease, func(isLeader bool) {
+			observability.LeaderTransitions.Inc()
+			if isLeader {
+				observability.Leader.Set(1)
+				log.LogInfo("Replica %s became the leader", id)
+			} else {
+				observability.Leader.Set(0)
+				log.LogInfo("Replica %s is now a follower", id)
+			}
+		})
+		health.RegisterCheck("leader", func() (string, bool) {
+			if elector.IsLeader() {
+				return "leader", true
+			}
+			return "follower", true
+		})
+		
+		// The leader publishes what it applies so that followers can keep
+		// their tracks without polling upstream themselves.
+		flightService.events = events.Multi(flightService.events, events.NewRedisPublisher(redisStore.Client(), updatesChannel))
+		go func() {
+			err := events.Subscribe(ctx, redisStore.Client(), updatesChannel, func(updates []types.FlightEvent) {
+				if !elector.IsLeader() {
+					flightService.followEvents(ctx, updates)
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				log.LogError("Failed to subscribe to %s: %v", updatesChannel, err)
+			}
+		}()
+		go elector.Run(ctx, flightService.lead)
+	} else {
+		go flightService.lead(ctx)
+	}
+	
+	var snapshots sync.WaitGroup
+	if cfg.SnapshotPath != "" {
+		snapshots.Add(1)
+		go func() {
+			defer snapshots.Done()
+			flightService.startSnapshots(ctx)
+		}()
+	}
 	
 	// Initialize tracing
 	tp, err := observability.InitTracing("flight-data-service", "http://jaeger:14268/api/traces")
@@ -114,8 +835,25 @@ func main() {
 	r.GET("/health", gin.WrapF(health.HealthHandler))
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.GET("/flights", flightService.GetAllFlights)
+	r.GET("/flights/nearby", flightService.GetNearbyFlights)
+	r.GET("/flights/:icao24", flightService.GetFlight)
+	r.GET("/flights/:icao24/track", flightService.GetTrack)
 	r.GET("/stats", flightService.GetStats)
 
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.LogError("Server shutdown failed: %v", err)
+		}
+	}()
+	
 	log.LogInfo("Flight Data Service starting on port %s", cfg.Port)
-	log.LogFatal("Server failed: %v", http.ListenAndServe(":"+cfg.Port, r))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.LogFatal("Server failed: %v", err)
+	}
+	snapshots.Wait()
+	log.LogInfo("Flight Data Service stopped")
 }
\ No newline at end of file
@@ -1,31 +1,97 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
-	"../../../pkg/config"
-	"../../../pkg/types"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/query"
+	"github.com/real-time-dashboard/backend/pkg/store"
+	"github.com/real-time-dashboard/backend/pkg/track"
+	"github.com/real-time-dashboard/backend/pkg/types"
 )
 
+// staticSource is a client.Source that always returns the same flights.
+type staticSource struct {
+	flights []types.Flight
+}
+
+func (s *staticSource) Name() string {
+	return "static"
+}
+
+func (s *staticSource) FetchFlights(ctx context.Context) ([]types.Flight, error) {
+	return s.flights, nil
+}
+
+// recordingPublisher is an events.Publisher that keeps every event.
+type recordingPublisher struct {
+	events []types.FlightEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, events []types.FlightEvent) error {
+	p.events = append(p.events, events...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+// putFlights stores flights as they are, bypassing the merger.
+func putFlights(t *testing.T, fs *FlightService, flights ...types.Flight) {
+	if err := fs.flights.Put(context.Background(), flights); err != nil {
+		t.Fatalf("Failed to store flights: %v", err)
+	}
+}
+
+func getFlight(t *testing.T, fs *FlightService, icao24 string) (types.Flight, bool) {
+	flight, ok, err := fs.flights.Get(context.Background(), icao24)
+	if err != nil {
+		t.Fatalf("Failed to get flight %s: %v", icao24, err)
+	}
+	return flight, ok
+}
+
+func countFlights(t *testing.T, fs *FlightService) int {
+	n, err := fs.flights.Len(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to count flights: %v", err)
+	}
+	return n
+}
+
+func countNearby(t *testing.T, fs *FlightService, lat, lon, radiusKm float64) int {
+	found, err := fs.flights.Nearby(context.Background(), lat, lon, radiusKm, 0)
+	if err != nil {
+		t.Fatalf("Nearby returned error: %v", err)
+	}
+	return len(found)
+}
+
 func TestFlightService_GetAllFlights(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
-	cfg := &config.Config{Port: "8081"}
-	fs := NewFlightService(cfg)
-	fs.flights["test123"] = types.Flight{
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	putFlights(t, fs, types.Flight{
 		ICAO24:        "test123",
 		Callsign:      "TEST123",
 		OriginCountry: "Test Country",
-		Longitude:     -122.4194,
-		Latitude:      37.7749,
+		Longitude:     types.Float64(-122.4194),
+		Latitude:      types.Float64(37.7749),
 		OnGround:      false,
-		Velocity:      250.5,
+		Velocity:      types.Float64(250.5),
 		LastUpdated:   time.Now(),
-	}
+	})
 	
 	r := gin.New()
 	r.GET("/flights", fs.GetAllFlights)
@@ -50,13 +116,319 @@ func TestFlightService_GetAllFlights(t *testing.T) {
 	}
 }
 
+func TestFlightService_GetAllFlightsPagesByDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	for i := 0; i < query.DefaultLimit+5; i++ {
+		putFlights(t, fs, types.Flight{ICAO24: fmt.Sprintf("a%05d", i)})
+	}
+	
+	r := gin.New()
+	r.GET("/flights", fs.GetAllFlights)
+	
+	req, _ := http.NewRequest("GET", "/flights", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	var flights []types.Flight
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	if len(flights) != query.DefaultLimit {
+		t.Errorf("Expected a page of %d flights without a limit, got %d", query.DefaultLimit, len(flights))
+	}
+	if total := w.Header().Get("X-Total-Count"); total != strconv.Itoa(query.DefaultLimit+5) {
+		t.Errorf("Expected X-Total-Count %d, got %q", query.DefaultLimit+5, total)
+	}
+	if w.Header().Get("X-Next-Cursor") == "" {
+		t.Error("Expected a next cursor")
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights?limit=5000", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	if len(flights) != query.DefaultLimit+5 || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("Expected every flight in one page up to the maximum, got %d", len(flights))
+	}
+}
+
+func TestFlightService_GetAllFlightsFiltered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	for _, id := range []string{"a00003", "a00001", "a00002"} {
+		putFlights(t, fs, types.Flight{ICAO24: id, OriginCountry: "Germany"})
+	}
+	putFlights(t, fs, types.Flight{ICAO24: "b00001", OriginCountry: "France"})
+	
+	r := gin.New()
+	r.GET("/flights", fs.GetAllFlights)
+	
+	req, _ := http.NewRequest("GET", "/flights?origin_country=Germany&limit=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var flights []types.Flight
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	
+	if len(flights) != 2 || flights[0].ICAO24 != "a00001" || flights[1].ICAO24 != "a00002" {
+		t.Fatalf("Expected a00001 and a00002, got %+v", flights)
+	}
+	
+	if total := w.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("Expected X-Total-Count 3, got %q", total)
+	}
+	
+	next := w.Header().Get("X-Next-Cursor")
+	if next == "" {
+		t.Fatal("Expected a next cursor")
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights?origin_country=Germany&limit=2&cursor="+next, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	if len(flights) != 1 || flights[0].ICAO24 != "a00003" {
+		t.Errorf("Expected a00003 on the second page, got %+v", flights)
+	}
+	
+	if next := w.Header().Get("X-Next-Cursor"); next != "" {
+		t.Errorf("Expected no cursor after the last page, got %q", next)
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights?sort=squawk", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid sort, got %d", w.Code)
+	}
+}
+
+func TestFlightService_GetNearbyFlights(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	fs.applyFlights(context.Background(), "static", []types.Flight{
+		{ICAO24: "400001", Latitude: types.Float64(51.4700), Longitude: types.Float64(-0.4543)},
+		{ICAO24: "400002", Latitude: types.Float64(51.1537), Longitude: types.Float64(-0.1821)},
+		{ICAO24: "39c001", Latitude: types.Float64(49.0097), Longitude: types.Float64(2.5479)},
+		{ICAO24: "400003"},
+	})
+	
+	r := gin.New()
+	r.GET("/flights/nearby", fs.GetNearbyFlights)
+	r.GET("/flights/:icao24", fs.GetFlight)
+	
+	req, _ := http.NewRequest("GET", "/flights/nearby?lat=51.5074&lon=-0.1278&radius_km=50", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var flights []types.NearbyFlight
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	
+	if len(flights) != 2 || flights[0].ICAO24 != "400001" || flights[1].ICAO24 != "400002" {
+		t.Fatalf("Expected 400001 then 400002, got %+v", flights)
+	}
+	
+	if flights[0].DistanceKm < 20 || flights[0].DistanceKm > 30 {
+		t.Errorf("Expected about 24 km to 400001, got %v", flights[0].DistanceKm)
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights/nearby?lat=51.5074&lon=-0.1278&radius_km=500&limit=1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	json.Unmarshal(w.Body.Bytes(), &flights)
+	if len(flights) != 1 {
+		t.Errorf("Expected limit to cap results at 1, got %d", len(flights))
+	}
+	
+	for _, q := range []string{"lat=91&lon=0", "lat=51&lon=0&radius_km=-1", "lon=0"} {
+		req, _ = http.NewRequest("GET", "/flights/nearby?"+q, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestFlightService_IndexFollowsUpdates(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, FlightTTL: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	
+	now := time.Now()
+	fs.applyFlights(context.Background(), "static", []types.Flight{{ICAO24: "3c6444", Latitude: types.Float64(48.35), Longitude: types.Float64(11.78), LastContact: now}})
+	fs.applyFlights(context.Background(), "static", []types.Flight{{ICAO24: "3c6444", Latitude: types.Float64(50.03), Longitude: types.Float64(8.57), LastContact: now}})
+	
+	if n := countNearby(t, fs, 48.35, 11.78, 10); n != 0 {
+		t.Errorf("Expected old position to be unindexed, got %d flights", n)
+	}
+	
+	if n := countNearby(t, fs, 50.03, 8.57, 10); n != 1 {
+		t.Errorf("Expected new position to be indexed, got %d flights", n)
+	}
+	
+	fs.evictStale(context.Background(), now.Add(2*time.Minute))
+	if n := countNearby(t, fs, 50.03, 8.57, 10); n != 0 {
+		t.Errorf("Expected evicted flight to leave the index, got %d flights", n)
+	}
+}
+
+func TestFlightService_GetTrack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, TrackLength: 3}
+	fs := NewFlightService(cfg, &staticSource{})
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 4; i++ {
+		fs.applyFlights(context.Background(), "static", []types.Flight{{
+			ICAO24:       "3c6444",
+			Callsign:     "DLH4AB",
+			Latitude:     types.Float64(48 + float64(i)/10),
+			Longitude:    types.Float64(11),
+			BaroAltitude: types.Float64(1000 * float64(i)),
+			TimePosition: types.Time(start.Add(time.Duration(i) * time.Minute)),
+			LastContact:  start.Add(time.Duration(i) * time.Minute),
+		}})
+	}
+	
+	r := gin.New()
+	r.GET("/flights/:icao24", fs.GetFlight)
+	r.GET("/flights/:icao24/track", fs.GetTrack)
+	
+	req, _ := http.NewRequest("GET", "/flights/3c6444/track?since=1700000100", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var trail struct {
+		ICAO24 string        `json:"icao24"`
+		Points []track.Point `json:"points"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &trail)
+	
+	if len(trail.Points) != 2 || trail.Points[0].Latitude != 48.2 || *trail.Points[1].Altitude != 3000 {
+		t.Errorf("Expected the last two positions, got %+v", trail.Points)
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights/3c6444/track?format=geojson&tolerance_m=500", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if ct := w.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Expected GeoJSON content type, got %q", ct)
+	}
+	
+	var feature track.Feature
+	json.Unmarshal(w.Body.Bytes(), &feature)
+	
+	// The buffer keeps 3 points on a straight line, simplified to its ends.
+	if feature.Geometry.Type != "LineString" || len(feature.Geometry.Coordinates) != 2 {
+		t.Errorf("Expected a simplified LineString, got %+v", feature.Geometry)
+	}
+	
+	req, _ = http.NewRequest("GET", "/flights/ffffff/track", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown aircraft, got %d", w.Code)
+	}
+}
+
+func TestFlightService_GetFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	fs.applyFlights(context.Background(), "opensky", []types.Flight{{
+		ICAO24:       "abc123",
+		Callsign:     "UAL123",
+		VerticalRate: types.Float64(10),
+		LastContact:  time.Now().Add(-30 * time.Second),
+	}})
+	
+	r := gin.New()
+	r.GET("/flights/:icao24", fs.GetFlight)
+	
+	req, _ := http.NewRequest("GET", "/flights/ABC123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var detail types.FlightDetail
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	
+	if detail.ICAO24 != "abc123" || detail.Callsign != "UAL123" {
+		t.Errorf("Expected flight abc123, got %+v", detail.Flight)
+	}
+	
+	if detail.Phase != types.PhaseClimb {
+		t.Errorf("Expected phase climb, got %s", detail.Phase)
+	}
+	
+	if detail.SecondsSinceContact < 30 || detail.SecondsSinceContact > 60 {
+		t.Errorf("Expected about 30 seconds since contact, got %v", detail.SecondsSinceContact)
+	}
+	
+	if len(detail.Sources) != 1 || detail.Sources[0] != "opensky" {
+		t.Errorf("Expected sources [opensky], got %v", detail.Sources)
+	}
+}
+
+func TestFlightService_GetFlightNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	
+	r := gin.New()
+	r.GET("/flights/:icao24", fs.GetFlight)
+	
+	req, _ := http.NewRequest("GET", "/flights/ffffff", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	
+	if body["error"] != "flight not found" || body["icao24"] != "ffffff" {
+		t.Errorf("Expected not found error body, got %v", body)
+	}
+}
+
 func TestFlightService_GetStats(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
-	cfg := &config.Config{Port: "8081"}
-	fs := NewFlightService(cfg)
-	fs.flights["air1"] = types.Flight{OnGround: false}
-	fs.flights["ground1"] = types.Flight{OnGround: true}
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	putFlights(t, fs, types.Flight{ICAO24: "air1", OnGround: false}, types.Flight{ICAO24: "ground1", OnGround: true})
 	
 	r := gin.New()
 	r.GET("/stats", fs.GetStats)
@@ -83,4 +455,320 @@ func TestFlightService_GetStats(t *testing.T) {
 	if stats.OnGround != 1 {
 		t.Errorf("Expected 1 on ground, got %d", stats.OnGround)
 	}
-}
\ No newline at end of file
+}
+func TestFlightService_ApplyFlightsMergesSources(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	
+	now := time.Now()
+	fs.applyFlights(context.Background(), "opensky", []types.Flight{{
+		ICAO24:        "3c6444",
+		OriginCountry: "Germany",
+		Latitude:      types.Float64(48.35),
+		Longitude:     types.Float64(11.78),
+		LastContact:   now.Add(-10 * time.Second),
+	}})
+	fs.applyFlights(context.Background(), "sbs", []types.Flight{{
+		ICAO24:      "3c6444",
+		Latitude:    types.Float64(48.36),
+		Longitude:   types.Float64(11.77),
+		LastContact: now,
+	}})
+	
+	flight, _ := getFlight(t, fs, "3c6444")
+	if flight.OriginCountry != "Germany" || *flight.Latitude != 48.36 {
+		t.Errorf("Expected merged record, got %+v", flight)
+	}
+	
+	if len(flight.Sources) != 2 {
+		t.Errorf("Expected both sources to be listed, got %v", flight.Sources)
+	}
+}
+
+func TestFlightService_EvictStale(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, FlightTTL: 5 * time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	
+	now := time.Now()
+	fs.applyFlights(context.Background(), "static", []types.Flight{
+		{ICAO24: "fresh1", LastContact: now.Add(-time.Minute)},
+		{ICAO24: "stale1", LastContact: now.Add(-10 * time.Minute)},
+		{ICAO24: "stale2", LastUpdated: now.Add(-6 * time.Minute)},
+	})
+	publisher := &recordingPublisher{}
+	fs.events = publisher
+	
+	evicted := fs.evictStale(context.Background(), now)
+	if len(evicted) != 2 {
+		t.Fatalf("Expected 2 evicted flights, got %v", evicted)
+	}
+	
+	if _, ok := getFlight(t, fs, "fresh1"); !ok || countFlights(t, fs) != 1 {
+		t.Errorf("Expected only fresh1 to remain, got %d flights", countFlights(t, fs))
+	}
+	
+	if len(publisher.events) != 2 {
+		t.Fatalf("Expected 2 removal events, got %d", len(publisher.events))
+	}
+	for _, event := range publisher.events {
+		if event.Type != types.FlightRemoved || event.Flight != nil {
+			t.Errorf("Expected removal event, got %+v", event)
+		}
+	}
+	
+	if evicted := fs.evictStale(context.Background(), now); len(evicted) != 0 {
+		t.Errorf("Expected nothing left to evict, got %v", evicted)
+	}
+}
+
+func TestFlightService_SnapshotRestore(t *testing.T) {
+	cfg := &config.Config{
+		Port:          "8081",
+		FetchInterval: time.Minute,
+		FlightTTL:     5 * time.Minute,
+		TrackLength:   10,
+		SnapshotPath:  filepath.Join(t.TempDir(), "flights.json.gz"),
+	}
+	now := time.Now()
+	
+	fs := NewFlightService(cfg, &staticSource{})
+	fs.applyFlights(context.Background(), "opensky", []types.Flight{
+		{ICAO24: "fresh1", Latitude: types.Float64(48.35), Longitude: types.Float64(11.78), LastContact: now.Add(-time.Minute)},
+		{ICAO24: "stale1", Latitude: types.Float64(50.03), Longitude: types.Float64(8.57), LastContact: now.Add(-4 * time.Minute)},
+	})
+	if err := fs.saveSnapshot(context.Background(), now); err != nil {
+		t.Fatalf("saveSnapshot returned error: %v", err)
+	}
+	
+	// The service restarts two minutes later, by which time stale1 has
+	// exceeded the TTL.
+	restarted := NewFlightService(cfg, &staticSource{})
+	restarted.restoreSnapshot(context.Background(), now.Add(2*time.Minute))
+	
+	flight, ok := getFlight(t, restarted, "fresh1")
+	if !ok || countFlights(t, restarted) != 1 {
+		t.Fatalf("Expected only fresh1 to be restored, got %d flights", countFlights(t, restarted))
+	}
+	
+	if flight.FieldSources["position"] != "opensky" {
+		t.Errorf("Expected attribution to be restored, got %v", flight.FieldSources)
+	}
+	
+	if n := countNearby(t, restarted, 48.35, 11.78, 1); n != 1 {
+		t.Errorf("Expected restored flight to be indexed, got %d flights", n)
+	}
+	
+	// An older update from another source must not overwrite restored values.
+	restarted.applyFlights(context.Background(), "sbs", []types.Flight{{ICAO24: "fresh1", Latitude: types.Float64(10), Longitude: types.Float64(10), LastContact: now.Add(-2 * time.Minute)}})
+	if flight, _ := getFlight(t, restarted, "fresh1"); *flight.Latitude != 48.35 {
+		t.Errorf("Expected restored position to be kept, got %v", *flight.Latitude)
+	}
+}
+
+func TestFlightService_RestoreMissingSnapshot(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, SnapshotPath: filepath.Join(t.TempDir(), "missing.json.gz")}
+	fs := NewFlightService(cfg, &staticSource{})
+	fs.restoreSnapshot(context.Background(), time.Now())
+	
+	if n := countFlights(t, fs); n != 0 {
+		t.Errorf("Expected no flights, got %d", n)
+	}
+}
+
+func TestFlightService_StartFetchingFetchesImmediately(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Hour}
+	source := &staticSource{flights: []types.Flight{{ICAO24: "3c6444", LastContact: time.Now()}}}
+	fs := NewFlightService(cfg, source)
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fs.startFetching(ctx, source)
+		close(done)
+	}()
+	
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if countFlights(t, fs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first fetch to happen without waiting for FETCH_INTERVAL")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	
+	cancel()
+	<-done
+}
+
+// streamingSource is a client.Streamer that emits n flights, calling
+// onEmit before each.
+type streamingSource struct {
+	staticSource
+	n      int
+	onEmit func(i int)
+}
+
+func (s *streamingSource) StreamFlights(ctx context.Context, emit func(types.Flight) error) error {
+	for i := 0; i < s.n; i++ {
+		s.onEmit(i)
+		if err := emit(types.Flight{ICAO24: fmt.Sprintf("%06x", i), LastContact: time.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFlightService_FetchAppliesStreamInBatches(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Hour}
+	fs := NewFlightService(cfg, &staticSource{})
+	
+	// Each batch is stored as soon as it is complete, before the rest of
+	// the response has been decoded.
+	var stored []int
+	source := &streamingSource{n: 2*streamBatchSize + 1}
+	source.onEmit = func(i int) {
+		if i%streamBatchSize == 0 {
+			stored = append(stored, countFlights(t, fs))
+		}
+	}
+	
+	applied, err := fs.fetch(context.Background(), source)
+	if err != nil || applied != source.n {
+		t.Fatalf("Expected %d flights to be applied, got %d: %v", source.n, applied, err)
+	}
+	if len(stored) != 3 || stored[0] != 0 || stored[1] != streamBatchSize || stored[2] != 2*streamBatchSize {
+		t.Errorf("Expected flights to be stored in batches of %d, got %v", streamBatchSize, stored)
+	}
+	if n := countFlights(t, fs); n != source.n {
+		t.Errorf("Expected %d flights, got %d", source.n, n)
+	}
+}
+
+func TestFlightService_ReplicasShareRedisStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, FlightTTL: 5 * time.Minute, Store: "redis", RedisURL: mr.Addr()}
+	replicas := make([]*FlightService, 2)
+	for i := range replicas {
+		flightStore, err := store.New(cfg)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		defer flightStore.Close()
+		replicas[i] = NewFlightService(cfg, &staticSource{})
+		replicas[i].flights = flightStore
+	}
+	
+	err := replicas[0].applyFlights(context.Background(), "opensky", []types.Flight{{
+		ICAO24:      "3c6444",
+		Callsign:    "DLH4AB",
+		Latitude:    types.Float64(48.35),
+		Longitude:   types.Float64(11.78),
+		LastContact: time.Now(),
+	}})
+	if err != nil {
+		t.Fatalf("applyFlights returned error: %v", err)
+	}
+	
+	r := gin.New()
+	r.GET("/flights/:icao24", replicas[1].GetFlight)
+	
+	req, _ := http.NewRequest("GET", "/flights/3c6444", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != 200 {
+		t.Fatalf("Expected the other replica to serve the flight, got status %d", w.Code)
+	}
+	
+	var detail types.FlightDetail
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	
+	if detail.Callsign != "DLH4AB" || len(detail.Sources) != 1 {
+		t.Errorf("Expected the stored flight, got %+v", detail.Flight)
+	}
+	
+	mr.Close()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 when Redis is down, got %d", w.Code)
+	}
+}
+
+func TestFlightService_FollowerTracksLeaderUpdates(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, FlightTTL: 5 * time.Minute, TrackLength: 10}
+	leader := NewFlightService(cfg, &staticSource{})
+	publisher := &recordingPublisher{}
+	leader.events = publisher
+	follower := NewFlightService(cfg, &staticSource{})
+	follower.flights = leader.flights
+	
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		leader.applyFlights(context.Background(), "static", []types.Flight{{
+			ICAO24:       "3c6444",
+			Latitude:     types.Float64(48.35 + float64(i)*0.01),
+			Longitude:    types.Float64(11.78),
+			TimePosition: types.Time(now.Add(time.Duration(i) * time.Second)),
+			LastContact:  now.Add(time.Duration(i) * time.Second),
+		}})
+	}
+	
+	if len(publisher.events) != 3 {
+		t.Fatalf("Expected 3 published updates, got %d", len(publisher.events))
+	}
+	for _, event := range publisher.events {
+		if event.Type != types.FlightUpdated || event.ICAO24 != "3c6444" || event.Flight == nil {
+			t.Fatalf("Expected update of 3c6444, got %+v", event)
+		}
+	}
+	
+	follower.followEvents(context.Background(), publisher.events)
+	if ring := follower.tracks["3c6444"]; ring == nil || ring.Len() != 3 {
+		t.Fatalf("Expected the follower to track 3 positions, got %v", ring)
+	}
+	
+	follower.followEvents(context.Background(), []types.FlightEvent{{Type: types.FlightRemoved, ICAO24: "3c6444"}})
+	if _, ok := follower.tracks["3c6444"]; ok {
+		t.Error("Expected the removal to drop the follower's track")
+	}
+}
+
+func TestFlightService_PublishesOnlyChangedFlights(t *testing.T) {
+	cfg := &config.Config{Port: "8081", FetchInterval: time.Minute, FlightTTL: 5 * time.Minute}
+	fs := NewFlightService(cfg, &staticSource{})
+	publisher := &recordingPublisher{}
+	fs.events = publisher
+	
+	contact := time.Now().Add(-time.Second)
+	fetch := func(lat float64) {
+		fs.applyFlights(context.Background(), "static", []types.Flight{
+			{ICAO24: "3c6444", Latitude: types.Float64(lat), Longitude: types.Float64(11.78), LastContact: contact, LastUpdated: time.Now()},
+			{ICAO24: "4ca2b6", Latitude: types.Float64(53.42), Longitude: types.Float64(-6.27), LastContact: contact, LastUpdated: time.Now()},
+		})
+	}
+	
+	fetch(48.35)
+	if len(publisher.events) != 2 {
+		t.Fatalf("Expected both new flights to be published, got %d events", len(publisher.events))
+	}
+	
+	fetch(48.35)
+	if len(publisher.events) != 2 {
+		t.Fatalf("Expected an unchanged fetch to publish nothing, got %d more events", len(publisher.events)-2)
+	}
+	
+	contact = contact.Add(time.Second)
+	fetch(48.36)
+	if len(publisher.events) != 4 {
+		t.Fatalf("Expected both refreshed flights to be published, got %d events", len(publisher.events))
+	}
+	if moved := publisher.events[2].Flight; moved == nil || *moved.Latitude != 48.36 {
+		t.Errorf("Expected the moved flight to carry its new position, got %+v", moved)
+	}
+}
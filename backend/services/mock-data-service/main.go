@@ -2,16 +2,15 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 	"github.com/gin-gonic/gin"
-	"github.com/segmentio/kafka-go"
 	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/events"
 	"github.com/real-time-dashboard/backend/pkg/health"
 	"github.com/real-time-dashboard/backend/pkg/log"
+	"github.com/real-time-dashboard/backend/pkg/schema"
 	"github.com/real-time-dashboard/backend/pkg/types"
 )
 
@@ -22,10 +21,10 @@ func generateMockFlights() []types.Flight {
 			ICAO24:        generateRandomICAO(),
 			Callsign:      generateRandomCallsign(),
 			OriginCountry: "Mock Country",
-			Longitude:     -180 + rand.Float64()*360,
-			Latitude:      -90 + rand.Float64()*180,
+			Longitude:     types.Float64(-180 + rand.Float64()*360),
+			Latitude:      types.Float64(-90 + rand.Float64()*180),
 			OnGround:      rand.Float64() < 0.3,
-			Velocity:      rand.Float64() * 500,
+			Velocity:      types.Float64(rand.Float64() * 500),
 			LastUpdated:   time.Now(),
 		}
 	}
@@ -46,43 +45,53 @@ func generateRandomCallsign() string {
 	return airlines[rand.Intn(len(airlines))] + "123"
 }
 
+// KafkaProducer publishes mock flights as updates through the same
+// validating publisher as flight-data-service, so that invalid records go
+// to the dead-letter topic instead of the flights topic.
 type KafkaProducer struct {
-	writer *kafka.Writer
+	publisher events.Publisher
 }
 
-func NewKafkaProducer(brokers, topic string) *KafkaProducer {
+func NewKafkaProducer(cfg *config.Config, codec schema.Codec, validator *schema.Validator) *KafkaProducer {
+	var deadLetter events.DeadLetter
+	if cfg.KafkaDeadLetterTopic != "" {
+		deadLetter = events.NewKafkaDeadLetter(cfg.KafkaBroker, cfg.KafkaDeadLetterTopic)
+	}
 	return &KafkaProducer{
-		writer: &kafka.Writer{
-			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
-			Topic:        topic,
-			Balancer:     &kafka.LeastBytes{},
-			RequiredAcks: kafka.RequireOne,
-			Compression:  kafka.Snappy,
-		},
+		publisher: events.Validating(events.NewKafkaPublisher(cfg.KafkaBroker, cfg.KafkaTopic, codec, cfg.KafkaBatchSize, cfg.KafkaBatchTimeout), validator, deadLetter),
 	}
 }
 
 func (p *KafkaProducer) PublishFlights(flights []types.Flight) error {
-	messages := make([]kafka.Message, 0, len(flights))
-	
-	for _, flight := range flights {
-		data, _ := json.Marshal(flight)
-		messages = append(messages, kafka.Message{
-			Key:   []byte(flight.ICAO24),
-			Value: data,
-			Time:  time.Now(),
-		})
+	updates := make([]types.FlightEvent, len(flights))
+	for i := range flights {
+		updates[i] = types.FlightEvent{Type: types.FlightUpdated, ICAO24: flights[i].ICAO24, Flight: &flights[i]}
 	}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
-	return p.writer.WriteMessages(ctx, messages...)
+	return p.publisher.Publish(ctx, updates)
+}
+
+func (p *KafkaProducer) Close() error {
+	return p.publisher.Close()
 }
 
 func main() {
 	cfg := config.Load()
-	producer := NewKafkaProducer(cfg.KafkaBroker, cfg.KafkaTopic)
+	codec, err := schema.NewCodec(cfg)
+	if err != nil {
+		log.LogFatal("Failed to create %s codec: %v", cfg.KafkaFormat, err)
+	}
+	validator, err := schema.NewFlightValidator(cfg)
+	if err != nil {
+		log.LogWarn("Validating flights without the registered schema: %v", err)
+	} else {
+		log.LogInfo("Validating flights against schema %d", validator.SchemaID())
+	}
+	producer := NewKafkaProducer(cfg, codec, validator)
+	defer producer.Close()
 	
 	// Start periodic publishing
 	go func() {
@@ -1,16 +1,38 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/real-time-dashboard/backend/pkg/client"
 	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/events"
+	"github.com/real-time-dashboard/backend/pkg/geo"
 	"github.com/real-time-dashboard/backend/pkg/health"
 	"github.com/real-time-dashboard/backend/pkg/log"
 	"github.com/real-time-dashboard/backend/pkg/middleware"
 	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/query"
+	"github.com/real-time-dashboard/backend/pkg/schema"
+	"github.com/real-time-dashboard/backend/pkg/types"
 )
 
 var upgrader = websocket.Upgrader{
@@ -19,44 +41,977 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type WSService struct {
-	clients map[*websocket.Conn]bool
+// Timeouts of a client connection, following the gorilla/websocket chat
+// example: a client that neither writes nor answers a ping within pongWait
+// is dropped.
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 16384
+)
+
+// connectionRetryAfter is how long clients turned away by a connection cap
+// are asked to wait before trying again.
+const connectionRetryAfter = 30 * time.Second
+
+// Errors returned when a connection would exceed a cap.
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrTooManyFromIP      = errors.New("too many connections from this address")
+)
+
+// sendQueueSize is the number of messages queued for a client before it is
+// considered too slow and disconnected.
+const sendQueueSize = 64
+
+// Message types sent to clients.
+const (
+	MessageSnapshot     = "snapshot"
+	MessageDiff         = "diff"
+	MessageSubscribed   = "subscribed"
+	MessageUnsubscribed = "unsubscribed"
+	MessageError        = "error"
+)
+
+// Message is sent to clients. A snapshot carries every aircraft in the
+// client's view in Flights and replaces whatever the client held. A diff
+// carries the changes to aircraft that changed or came into view, the
+// ICAO24 addresses of aircraft that are no longer tracked in Removed, and
+// of those that no longer match the client's subscription, e.g. because
+// they left its viewport, in Left.
+//
+// Snapshots and diffs are numbered by Seq, counting up from 1 for each
+// client. A client that sees a gap has missed a diff and should ask for a
+// resync.
+type Message struct {
+	Seq     uint64              `json:"seq,omitempty"`
+	Type    string              `json:"type"`
+	Flights []types.Flight      `json:"flights,omitempty"`
+	Changes []FlightDiff        `json:"changes,omitempty"`
+	Removed []string            `json:"removed,omitempty"`
+	Left    []string            `json:"left,omitempty"`
+	Filter  *SubscriptionFilter `json:"filter,omitempty"`
+	Error   string              `json:"error,omitempty"`
 }
 
-func NewWSService() *WSService {
-	return &WSService{
-		clients: make(map[*websocket.Conn]bool),
+func (m Message) empty() bool {
+	return len(m.Changes) == 0 && len(m.Removed) == 0 && len(m.Left) == 0
+}
+
+// FlightDiff holds the fields of a flight that changed, keyed by their JSON
+// names, together with its icao24. Fields that became unknown are null.
+// Applying a diff means overwriting the client's copy of the flight with
+// each of its fields, and the diff of an aircraft the client did not have
+// holds every field.
+type FlightDiff map[string]json.RawMessage
+
+var jsonNull = json.RawMessage("null")
+
+// diffFlight returns the diff that turns before into after, or nil if
+// nothing changed. A nil before yields every field of after.
+func diffFlight(before *types.Flight, after types.Flight) FlightDiff {
+	next, err := flightFields(after)
+	if err != nil {
+		log.LogError("Failed to encode flight %s: %v", after.ICAO24, err)
+		return nil
+	}
+	if before == nil {
+		return next
 	}
+	prev, err := flightFields(*before)
+	if err != nil {
+		log.LogError("Failed to encode flight %s: %v", before.ICAO24, err)
+		return next
+	}
+
+	diff := FlightDiff{}
+	for field, value := range next {
+		if !bytes.Equal(prev[field], value) {
+			diff[field] = value
+		}
+	}
+	for field := range prev {
+		if _, ok := next[field]; !ok {
+			diff[field] = jsonNull
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	diff["icao24"] = next["icao24"]
+	return diff
 }
 
-func (ws *WSService) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+func flightFields(flight types.Flight) (FlightDiff, error) {
+	data, err := json.Marshal(flight)
 	if err != nil {
-		log.LogError("WebSocket upgrade failed: %v", err)
+		return nil, err
+	}
+	var fields FlightDiff
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// Control message types sent by clients.
+const (
+	ControlSubscribe      = "subscribe"
+	ControlUnsubscribe    = "unsubscribe"
+	ControlUpdateViewport = "update_viewport"
+	ControlResync         = "resync"
+)
+
+// ControlMessage is sent by clients to change their subscription.
+// Subscribe replaces the filter, unsubscribe stops all updates and
+// update_viewport replaces only the bbox of the current filter. Resync
+// asks for a new snapshot of the current view.
+type ControlMessage struct {
+	Type   string              `json:"type"`
+	Filter *SubscriptionFilter `json:"filter,omitempty"`
+	BBox   *geo.BBox           `json:"bbox,omitempty"`
+}
+
+// SubscriptionFilter selects the aircraft a client is sent. Unset
+// criteria match every aircraft, so an empty filter subscribes to all.
+type SubscriptionFilter struct {
+	BBox          *geo.BBox `json:"bbox,omitempty"`
+	ICAO24        []string  `json:"icao24,omitempty"`
+	Callsign      string    `json:"callsign,omitempty"`
+	OriginCountry string    `json:"origin_country,omitempty"`
+	MinAltitude   *float64  `json:"min_altitude,omitempty"`
+	MaxAltitude   *float64  `json:"max_altitude,omitempty"`
+}
+
+// Filter converts the subscription to the query filter used by the
+// flight APIs.
+func (s SubscriptionFilter) Filter() (query.Filter, error) {
+	if s.BBox != nil {
+		if err := s.BBox.Validate(); err != nil {
+			return query.Filter{}, err
+		}
+	}
+	if s.MinAltitude != nil && s.MaxAltitude != nil && *s.MinAltitude > *s.MaxAltitude {
+		return query.Filter{}, errors.New("min_altitude is above max_altitude")
+	}
+
+	f := query.Filter{
+		BBox:           s.BBox,
+		OriginCountry:  strings.TrimSpace(s.OriginCountry),
+		CallsignPrefix: strings.ToUpper(strings.TrimSpace(s.Callsign)),
+		MinAltitude:    s.MinAltitude,
+		MaxAltitude:    s.MaxAltitude,
+	}
+	if len(s.ICAO24) > 0 {
+		f.ICAO24 = query.ICAO24Set(s.ICAO24)
+	}
+	return f, nil
+}
+
+// describe summarises a subscription for the connection registry.
+func describe(spec *SubscriptionFilter, everything bool) string {
+	switch {
+	case spec == nil:
+		return subscriptionNone
+	case everything:
+		return subscriptionAll
+	}
+	data, _ := json.Marshal(spec)
+	return string(data)
+}
+
+// UpdateSource delivers flight events to handle until ctx is cancelled.
+type UpdateSource func(ctx context.Context, handle func([]types.FlightEvent)) error
+
+// Descriptions of the subscription of a client that receives every
+// update and of one that has unsubscribed.
+const (
+	subscriptionAll  = "all"
+	subscriptionNone = "none"
+)
+
+// Client is a connected WebSocket client. Messages are queued on send and
+// written by the client's own goroutine, so a slow client never holds up
+// the others.
+type Client struct {
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	id          string
+	remoteIP    string
+	connectedAt time.Time
+	bytesSent   int64
+
+	mu           sync.Mutex
+	subscription string
+
+	// The view of the client, guarded by the hub's mu. A nil spec means the
+	// client has unsubscribed. visible holds the aircraft the client has
+	// been sent, except when it receives everything. seq numbers the last
+	// snapshot or diff sent.
+	spec       *SubscriptionFilter
+	filter     query.Filter
+	everything bool
+	visible    map[string]struct{}
+	seq        uint64
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, remoteIP string) *Client {
+	return &Client{
+		hub:          hub,
+		conn:         conn,
+		send:         make(chan []byte, sendQueueSize),
+		id:           newClientID(),
+		remoteIP:     remoteIP,
+		connectedAt:  time.Now(),
+		subscription: subscriptionAll,
+		spec:         &SubscriptionFilter{},
+		everything:   true,
+	}
+}
+
+// newClientID returns a random identifier for a connection.
+func newClientID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ConnectionInfo describes a connected client.
+type ConnectionInfo struct {
+	ID           string    `json:"id"`
+	RemoteIP     string    `json:"remote_ip"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	Subscription string    `json:"subscription"`
+	BytesSent    int64     `json:"bytes_sent"`
+}
+
+// Info returns the metadata of the connection.
+func (c *Client) Info() ConnectionInfo {
+	c.mu.Lock()
+	subscription := c.subscription
+	c.mu.Unlock()
+	return ConnectionInfo{
+		ID:           c.id,
+		RemoteIP:     c.remoteIP,
+		ConnectedAt:  c.connectedAt,
+		Subscription: subscription,
+		BytesSent:    atomic.LoadInt64(&c.bytesSent),
+	}
+}
+
+// Registry is the set of connected clients. It is safe for concurrent use
+// and keeps gauge, normally websocket_active_connections, in step with its
+// size.
+//
+// It also enforces at most maxTotal connections overall and maxPerIP from
+// each remote IP, where zero means no limit. A slot is reserved before the
+// upgrade and held until the client is removed, so that concurrent
+// upgrades cannot overshoot the caps.
+type Registry struct {
+	mu       sync.RWMutex
+	clients  map[string]*Client
+	gauge    prometheus.Gauge
+	maxTotal int
+	maxPerIP int
+	slots    int
+	perIP    map[string]int
+}
+
+func NewRegistry(gauge prometheus.Gauge, maxTotal, maxPerIP int) *Registry {
+	return &Registry{
+		clients:  make(map[string]*Client),
+		gauge:    gauge,
+		maxTotal: maxTotal,
+		maxPerIP: maxPerIP,
+		perIP:    make(map[string]int),
+	}
+}
+
+// Reserve takes a slot for a connection from ip, or returns
+// ErrTooManyConnections or ErrTooManyFromIP if a cap is reached. The slot
+// is handed to the client passed to Add, or given back with Release if the
+// connection is not established.
+func (r *Registry) Reserve(ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxTotal > 0 && r.slots >= r.maxTotal {
+		return ErrTooManyConnections
+	}
+	if r.maxPerIP > 0 && r.perIP[ip] >= r.maxPerIP {
+		return ErrTooManyFromIP
+	}
+	r.slots++
+	r.perIP[ip]++
+	return nil
+}
+
+// Release gives back a slot taken by Reserve that was not used.
+func (r *Registry) Release(ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release(ip)
+}
+
+func (r *Registry) release(ip string) {
+	r.slots--
+	if r.perIP[ip]--; r.perIP[ip] <= 0 {
+		delete(r.perIP, ip)
+	}
+}
+
+// Add registers client in the slot reserved for its IP and returns the
+// number of connected clients.
+func (r *Registry) Add(client *Client) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client.id] = client
+	r.gauge.Set(float64(len(r.clients)))
+	return len(r.clients)
+}
+
+// Remove unregisters client, frees its slot and closes its queue, which
+// stops its writer. It reports whether the client was still registered, so
+// that the queue is closed exactly once.
+func (r *Registry) Remove(client *Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients[client.id] != client {
+		return false
+	}
+	delete(r.clients, client.id)
+	r.release(client.remoteIP)
+	close(client.send)
+	r.gauge.Set(float64(len(r.clients)))
+	return true
+}
+
+// Len returns the number of connected clients.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// Send queues data for client unless it has been removed. It reports
+// false if the client's queue is full.
+func (r *Registry) Send(client *Client, data []byte) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.clients[client.id] != client {
+		return true
+	}
+	select {
+	case client.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// Each calls fn for every connected client. Clients cannot be removed
+// while it runs, so fn may send to their queues.
+func (r *Registry) Each(fn func(client *Client)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, client := range r.clients {
+		fn(client)
+	}
+}
+
+// Connections returns the metadata of every connected client, oldest
+// first.
+func (r *Registry) Connections() []ConnectionInfo {
+	var infos []ConnectionInfo
+	r.Each(func(client *Client) {
+		infos = append(infos, client.Info())
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
+
+// Hub fans flight updates out to the connected clients, sending each only
+// the aircraft matching its subscription. Updates are coalesced per
+// aircraft and broadcast every interval. Aircraft not seen for ttl are
+// dropped and sent as removed, since not every producer publishes
+// removals; a zero ttl keeps them until they are removed. A source that
+// fails is restarted with backoff.
+type Hub struct {
+	interval time.Duration
+	ttl      time.Duration
+	clients  *Registry
+	backoff  *client.Backoff
+
+	pendingMu sync.Mutex
+	pending   map[string]*types.Flight
+
+	// mu guards state, the latest known flights, and the views of clients.
+	mu    sync.Mutex
+	state map[string]types.Flight
+}
+
+func NewHub(interval, ttl time.Duration, clients *Registry) *Hub {
+	return &Hub{
+		interval: interval,
+		ttl:      ttl,
+		clients:  clients,
+		backoff:  client.NewBackoff(time.Second, time.Minute),
+		pending:  make(map[string]*types.Flight),
+		state:    make(map[string]types.Flight),
+	}
+}
+
+// Len returns the number of connected clients.
+func (h *Hub) Len() int {
+	return h.clients.Len()
+}
+
+// Run consumes source and broadcasts its updates until ctx is cancelled,
+// then disconnects every client.
+func (h *Hub) Run(ctx context.Context, source UpdateSource) {
+	go h.consume(ctx, source)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
+		case now := <-ticker.C:
+			h.flush(now)
+		}
+	}
+}
+
+// consume runs source until ctx is cancelled, restarting it with backoff
+// whenever it stops. The backoff is reset once a run delivers events.
+func (h *Hub) consume(ctx context.Context, source UpdateSource) {
+	attempt := 0
+	for {
+		delivered := false
+		err := source(ctx, func(events []types.FlightEvent) {
+			delivered = true
+			h.enqueue(events)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if delivered {
+			attempt = 0
+		}
+		attempt++
+	
+		delay := h.backoff.Delay(attempt)
+		log.LogError("Flight update source stopped, restarting in %v: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// enqueue records events to be sent with the next broadcast. Only the
+// latest state of each aircraft is kept.
+func (h *Hub) enqueue(events []types.FlightEvent) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	for _, event := range events {
+		switch event.Type {
+		case types.FlightUpdated:
+			if event.Flight != nil {
+				h.pending[event.ICAO24] = event.Flight
+			}
+		case types.FlightRemoved:
+			h.pending[event.ICAO24] = nil
+		}
+	}
+}
+
+// change is the update of an aircraft in a broadcast. diff is relative to
+// the previous state and full, for clients that did not have the aircraft,
+// is only computed when needed.
+type change struct {
+	flight types.Flight
+	diff   FlightDiff
+	full   FlightDiff
+}
+
+func (c *change) fullDiff() FlightDiff {
+	if c.full == nil {
+		c.full = diffFlight(nil, c.flight)
+	}
+	return c.full
+}
+
+// flush applies the pending updates to the state, drops the aircraft
+// that expired by now and sends every client the diff of the part it
+// subscribed to.
+func (h *Hub) flush(now time.Time) {
+	h.pendingMu.Lock()
+	pending := h.pending
+	h.pending = make(map[string]*types.Flight)
+	h.pendingMu.Unlock()
+	if len(pending) == 0 && h.ttl == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	var changes []*change
+	var removed []string
+	ids := make([]string, 0, len(pending))
+	for icao24 := range pending {
+		ids = append(ids, icao24)
+	}
+	sort.Strings(ids)
+	for _, icao24 := range ids {
+		flight := pending[icao24]
+		if flight != nil && h.expired(*flight, now) {
+			// A late update of an aircraft that has already expired is
+			// a removal, and one of an untracked aircraft is ignored.
+			if _, ok := h.state[icao24]; !ok {
+				continue
+			}
+			flight = nil
+		}
+		if flight == nil {
+			delete(h.state, icao24)
+			removed = append(removed, icao24)
+			continue
+		}
+
+		c := &change{flight: *flight}
+		if before, ok := h.state[icao24]; ok {
+			c.diff = diffFlight(&before, *flight)
+		} else {
+			c.diff = diffFlight(nil, *flight)
+			c.full = c.diff
+		}
+		h.state[icao24] = *flight
+		if c.diff != nil {
+			changes = append(changes, c)
+		}
+	}
+	removed = append(removed, h.expire(now)...)
+	if len(changes) == 0 && len(removed) == 0 {
+		h.mu.Unlock()
 		return
 	}
-	defer conn.Close()
 
-	ws.clients[conn] = true
-	log.LogInfo("Client connected. Total: %d", len(ws.clients))
+	// Clients receiving everything share one encoded diff, which is only
+	// numbered for each of them.
+	var all []byte
+	var slow []*Client
+	h.clients.Each(func(client *Client) {
+		var data []byte
+		switch {
+		case client.spec == nil:
+			return
+		case client.everything:
+			if all == nil {
+				diffs := make([]FlightDiff, len(changes))
+				for i, c := range changes {
+					diffs[i] = c.diff
+				}
+				all = encode(Message{Type: MessageDiff, Changes: diffs, Removed: removed})
+			}
+			client.seq++
+			data = sequenced(all, client.seq)
+		default:
+			message := client.view(changes, removed)
+			if message.empty() {
+				return
+			}
+			client.seq++
+			message.Seq = client.seq
+			data = encode(message)
+		}
+		select {
+		case client.send <- data:
+		default:
+			slow = append(slow, client)
+		}
+	})
+	h.mu.Unlock()
+
+	for _, client := range slow {
+		log.LogWarn("Disconnecting slow client %s from %s", client.id, client.remoteIP)
+		h.unregister(client)
+	}
+}
+
+// expired reports whether flight has not been seen within the TTL.
+func (h *Hub) expired(flight types.Flight, now time.Time) bool {
+	return h.ttl > 0 && flight.LastSeen().Before(now.Add(-h.ttl))
+}
+
+// expire removes the aircraft that have not been seen within the TTL from
+// the state and returns them in order. The caller holds mu.
+func (h *Hub) expire(now time.Time) []string {
+	var expired []string
+	for icao24, flight := range h.state {
+		if h.expired(flight, now) {
+			delete(h.state, icao24)
+			expired = append(expired, icao24)
+		}
+	}
+	if len(expired) > 0 {
+		sort.Strings(expired)
+		log.LogDebug("Expired %d aircraft not seen for %v", len(expired), h.ttl)
+	}
+	return expired
+}
+
+// view returns the diff of the part of an update that client subscribed
+// to, with the aircraft that stopped matching its filter as left. The
+// caller holds the hub's mu.
+func (c *Client) view(changes []*change, removed []string) Message {
+	message := Message{Type: MessageDiff}
+	for _, change := range changes {
+		icao24 := change.flight.ICAO24
+		_, seen := c.visible[icao24]
+		switch {
+		case c.filter.Match(change.flight) && seen:
+			message.Changes = append(message.Changes, change.diff)
+		case c.filter.Match(change.flight):
+			c.visible[icao24] = struct{}{}
+			message.Changes = append(message.Changes, change.fullDiff())
+		case seen:
+			delete(c.visible, icao24)
+			message.Left = append(message.Left, icao24)
+		}
+	}
+	for _, icao24 := range removed {
+		if _, seen := c.visible[icao24]; seen {
+			delete(c.visible, icao24)
+			message.Removed = append(message.Removed, icao24)
+		}
+	}
+	return message
+}
+
+// handleControl applies a control message from client, replying with an
+// error message if it is invalid.
+func (h *Hub) handleControl(client *Client, data []byte) {
+	var control ControlMessage
+	var err error
+	if err = json.Unmarshal(data, &control); err != nil {
+		err = fmt.Errorf("invalid control message: %v", err)
+	} else {
+		switch control.Type {
+		case ControlSubscribe:
+			spec := &SubscriptionFilter{}
+			if control.Filter != nil {
+				spec = control.Filter
+			}
+			err = h.subscribe(client, spec)
+		case ControlUnsubscribe:
+			err = h.subscribe(client, nil)
+		case ControlUpdateViewport:
+			err = h.updateViewport(client, control.BBox)
+		case ControlResync:
+			h.resync(client)
+		default:
+			err = fmt.Errorf("unknown message type %q", control.Type)
+		}
+	}
+	if err != nil {
+		h.reply(client, Message{Type: MessageError, Error: err.Error()})
+	}
+}
+
+// subscribe replaces the subscription of client, or ends it if spec is
+// nil, and sends the aircraft that came into or left its view.
+func (h *Hub) subscribe(client *Client, spec *SubscriptionFilter) error {
+	var filter query.Filter
+	if spec != nil {
+		var err error
+		if filter, err = spec.Filter(); err != nil {
+			return err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	update := h.resubscribe(client, spec, filter)
+	if spec == nil {
+		h.reply(client, Message{Type: MessageUnsubscribed})
+	} else {
+		h.reply(client, Message{Type: MessageSubscribed, Filter: spec})
+	}
+	if !update.empty() {
+		h.sendView(client, update)
+	}
+	return nil
+}
+
+// updateViewport replaces the bbox of the subscription of client.
+func (h *Hub) updateViewport(client *Client, box *geo.BBox) error {
+	h.mu.Lock()
+	if client.spec == nil {
+		h.mu.Unlock()
+		return errors.New("not subscribed")
+	}
+	spec := *client.spec
+	h.mu.Unlock()
+
+	spec.BBox = box
+	return h.subscribe(client, &spec)
+}
+
+// resubscribe switches client to a new view of the state and returns the
+// diff that brings it in line: every field of the aircraft that came into
+// view and the aircraft that left it. The caller holds mu.
+func (h *Hub) resubscribe(client *Client, spec *SubscriptionFilter, filter query.Filter) Message {
+	before := client.visible
+	if client.spec != nil && client.everything {
+		before = make(map[string]struct{}, len(h.state))
+		for icao24 := range h.state {
+			before[icao24] = struct{}{}
+		}
+	}
+
+	client.spec = spec
+	client.filter = filter
+	client.everything = spec != nil && filter.IsZero()
+	after := make(map[string]struct{})
+	var entered []string
+	if spec != nil {
+		for icao24, flight := range h.state {
+			if !client.everything && !filter.Match(flight) {
+				continue
+			}
+			after[icao24] = struct{}{}
+			if _, seen := before[icao24]; !seen {
+				entered = append(entered, icao24)
+			}
+		}
+	}
+	message := Message{Type: MessageDiff}
+	sort.Strings(entered)
+	for _, icao24 := range entered {
+		if diff := diffFlight(nil, h.state[icao24]); diff != nil {
+			message.Changes = append(message.Changes, diff)
+		}
+	}
+	for icao24 := range before {
+		if _, ok := after[icao24]; !ok {
+			message.Left = append(message.Left, icao24)
+		}
+	}
+	sort.Strings(message.Left)
+
+	client.visible = after
+	if client.everything {
+		client.visible = nil
+	}
+	client.mu.Lock()
+	client.subscription = describe(spec, client.everything)
+	client.mu.Unlock()
+	return message
+}
+
+// resync sends client a new snapshot of its view, e.g. after it missed a
+// diff.
+func (h *Hub) resync(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot(client)
+}
+
+// snapshot sends client every aircraft in its view. The caller holds mu.
+func (h *Hub) snapshot(client *Client) {
+	message := Message{Type: MessageSnapshot}
+	if client.spec != nil {
+		for icao24, flight := range h.state {
+			if _, ok := client.visible[icao24]; ok || client.everything {
+				message.Flights = append(message.Flights, flight)
+			}
+		}
+	}
+	sort.Slice(message.Flights, func(i, j int) bool {
+		return message.Flights[i].ICAO24 < message.Flights[j].ICAO24
+	})
+	h.sendView(client, message)
+}
+
+// sendView numbers message as the next snapshot or diff of client and
+// queues it. The caller holds mu.
+func (h *Hub) sendView(client *Client, message Message) {
+	client.seq++
+	message.Seq = client.seq
+	h.reply(client, message)
+}
+
+// reply queues a message for client, disconnecting it if its queue is
+// full.
+func (h *Hub) reply(client *Client, message Message) {
+	if !h.clients.Send(client, encode(message)) {
+		log.LogWarn("Disconnecting slow client %s from %s", client.id, client.remoteIP)
+		h.unregister(client)
+	}
+}
+
+func encode(message Message) []byte {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.LogError("Failed to encode %s message: %v", message.Type, err)
+	}
+	return data
+}
+
+// sequenced numbers a message encoded without a Seq.
+func sequenced(data []byte, seq uint64) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	numbered := make([]byte, 0, len(data)+24)
+	numbered = append(numbered, `{"seq":`...)
+	numbered = strconv.AppendUint(numbered, seq, 10)
+	numbered = append(numbered, ',')
+	return append(numbered, data[1:]...)
+}
+
+// register adds a client for conn and sends it a snapshot of every
+// aircraft. Both happen under mu, so that no diff can overtake the
+// snapshot.
+func (h *Hub) register(conn *websocket.Conn, remoteIP string) *Client {
+	client := newClient(h, conn, remoteIP)
+	h.mu.Lock()
+	total := h.clients.Add(client)
+	h.snapshot(client)
+	h.mu.Unlock()
+	log.LogInfo("Client %s connected from %s. Total: %d", client.id, remoteIP, total)
+	return client
+}
+
+func (h *Hub) unregister(client *Client) {
+	if h.clients.Remove(client) {
+		log.LogInfo("Client %s disconnected. Total: %d", client.id, h.clients.Len())
+	}
+}
+
+func (h *Hub) closeAll() {
+	var clients []*Client
+	h.clients.Each(func(client *Client) {
+		clients = append(clients, client)
+	})
+	for _, client := range clients {
+		h.unregister(client)
+	}
+}
+
+// writePump writes queued messages to the connection and pings it, until
+// the queue is closed or a write fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
 
 	for {
-		_, _, err := conn.ReadMessage()
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+			atomic.AddInt64(&c.bytesSent, int64(len(data)))
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPump reads control messages from the connection until it fails,
+// keeping the read deadline ahead of the pings.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			delete(ws.clients, conn)
-			log.LogInfo("Client disconnected. Total: %d", len(ws.clients))
-			break
+			return
 		}
+		c.hub.handleControl(c, data)
+	}
+}
+
+type WSService struct {
+	hub *Hub
+}
+
+func NewWSService(cfg *config.Config) *WSService {
+	return &WSService{
+		hub: NewHub(cfg.BroadcastInterval, cfg.FlightTTL, NewRegistry(observability.ActiveConnections, cfg.MaxConnections, cfg.MaxConnectionsPerIP)),
 	}
 }
 
+func (ws *WSService) HandleWebSocket(c *gin.Context) {
+	ip := c.ClientIP()
+	if err := ws.hub.clients.Reserve(ip); err != nil {
+		status, reason := http.StatusServiceUnavailable, "max_connections"
+		if err == ErrTooManyFromIP {
+			status, reason = http.StatusTooManyRequests, "max_connections_per_ip"
+		}
+		observability.WebSocketRejectedUpgrades.WithLabelValues(reason).Inc()
+		log.LogWarn("Rejected WebSocket upgrade from %s: %v", ip, err)
+		c.Header("Retry-After", strconv.Itoa(int(connectionRetryAfter.Seconds())))
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		ws.hub.clients.Release(ip)
+		log.LogError("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	client := ws.hub.register(conn, ip)
+	go client.writePump()
+	client.readPump()
+}
+
 func (ws *WSService) GetMetrics(c *gin.Context) {
-	c.JSON(200, gin.H{"connections": len(ws.clients)})
+	connections := ws.hub.clients.Connections()
+	c.JSON(200, gin.H{"connections": len(connections), "clients": connections})
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	
 	cfg := config.Load()
-	wsService := NewWSService()
+	wsService := NewWSService(cfg)
+	
+	codec, err := schema.NewCodec(cfg)
+	if err != nil {
+		log.LogFatal("Failed to create %s codec: %v", cfg.KafkaFormat, err)
+	}
+	hostname, _ := os.Hostname()
+	group := fmt.Sprintf("websocket-service-%s-%d", hostname, os.Getpid())
+	subscriber := events.NewKafkaSubscriber(cfg.KafkaBroker, cfg.KafkaTopic, group, codec)
+	defer subscriber.Close()
+	go wsService.hub.Run(ctx, subscriber.Run)
 	
 	// Initialize tracing
 	tp, err := observability.InitTracing("websocket-service", "http://jaeger:14268/api/traces")
@@ -70,6 +1025,11 @@ func main() {
 	}()
 	
 	r := gin.Default()
+	// Connections are capped by client address, which is only taken from
+	// X-Forwarded-For on requests from the gateway.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.LogFatal("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	
 	// Apply middleware
 	r.Use(middleware.TracingMiddleware("websocket-service"))
@@ -80,6 +1040,19 @@ func main() {
 	r.GET("/ws", wsService.HandleWebSocket)
 	r.GET("/ws-metrics", wsService.GetMetrics)
 
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.LogError("Server shutdown failed: %v", err)
+		}
+	}()
+	
 	log.LogInfo("WebSocket Service starting on port %s", cfg.Port)
-	log.LogFatal("Server failed: %v", http.ListenAndServe(":"+cfg.Port, r))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.LogFatal("Server failed: %v", err)
+	}
+	log.LogInfo("WebSocket Service stopped")
 }
\ No newline at end of file
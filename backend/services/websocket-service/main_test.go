@@ -1,18 +1,105 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/real-time-dashboard/backend/pkg/client"
+	"github.com/real-time-dashboard/backend/pkg/config"
+	"github.com/real-time-dashboard/backend/pkg/geo"
+	"github.com/real-time-dashboard/backend/pkg/observability"
+	"github.com/real-time-dashboard/backend/pkg/query"
+	"github.com/real-time-dashboard/backend/pkg/types"
 )
 
+// channelSource is an in-process UpdateSource fed by a channel.
+func channelSource(updates <-chan []types.FlightEvent) UpdateSource {
+	return func(ctx context.Context, handle func([]types.FlightEvent)) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case events := <-updates:
+				handle(events)
+			}
+		}
+	}
+}
+
+// startService serves a WSService configured by cfg and fed by updates,
+// and returns its /ws URL.
+func startService(t *testing.T, cfg *config.Config, updates <-chan []types.FlightEvent) (*WSService, string) {
+	gin.SetMode(gin.TestMode)
+	if cfg.BroadcastInterval == 0 {
+		cfg.BroadcastInterval = 10 * time.Millisecond
+	}
+	ws := NewWSService(cfg)
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ws.hub.Run(ctx, channelSource(updates))
+	
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies returned error: %v", err)
+	}
+	r.GET("/ws", ws.HandleWebSocket)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return ws, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// dial connects to url, through a proxy forwarding for the given
+// addresses if there are any.
+func dial(t *testing.T, url string, forwardedFor ...string) *websocket.Conn {
+	var header http.Header
+	if len(forwardedFor) > 0 {
+		header = http.Header{"X-Forwarded-For": {strings.Join(forwardedFor, ", ")}}
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) Message {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return message
+}
+
 func TestWSService_GetMetrics(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
-	ws := NewWSService()
+	ws := NewWSService(&config.Config{BroadcastInterval: time.Second})
 	
 	r := gin.New()
 	r.GET("/metrics", ws.GetMetrics)
@@ -49,4 +136,688 @@ func TestWSService_HealthCheck(t *testing.T) {
 	if !strings.Contains(w.Body.String(), "healthy") {
 		t.Error("Expected response to contain 'healthy'")
 	}
-}
\ No newline at end of file
+}
+
+func TestHub_BroadcastsUpdatesToEveryClient(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	ws, url := startService(t, &config.Config{}, updates)
+	
+	clients := []*websocket.Conn{dial(t, url), dial(t, url)}
+	for i, conn := range clients {
+		if message := readMessage(t, conn); message.Type != MessageSnapshot || message.Seq != 1 || len(message.Flights) != 0 {
+			t.Errorf("Expected client %d to start with an empty snapshot, got %+v", i, message)
+		}
+	}
+	
+	flight := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", Latitude: types.Float64(48.35), Longitude: types.Float64(11.78)}
+	updates <- []types.FlightEvent{{Type: types.FlightUpdated, ICAO24: flight.ICAO24, Flight: &flight}}
+	for i, conn := range clients {
+		message := readMessage(t, conn)
+		if message.Type != MessageDiff || message.Seq != 2 || len(message.Changes) != 1 || string(message.Changes[0]["callsign"]) != `"DLH4AB"` {
+			t.Errorf("Expected client %d to receive the update, got %+v", i, message)
+		}
+	}
+	
+	updates <- []types.FlightEvent{{Type: types.FlightRemoved, ICAO24: "3c6444"}}
+	for i, conn := range clients {
+		message := readMessage(t, conn)
+		if message.Seq != 3 || len(message.Changes) != 0 || len(message.Removed) != 1 || message.Removed[0] != "3c6444" {
+			t.Errorf("Expected client %d to receive the removal, got %+v", i, message)
+		}
+	}
+	
+	clients[0].Close()
+	waitFor(t, "the client to unregister", func() bool { return ws.hub.Len() == 1 })
+}
+
+func TestHub_CoalescesUpdatesPerAircraft(t *testing.T) {
+	hub := NewHub(time.Minute, 0, NewRegistry(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_connections"}), 0, 0))
+	client := newClient(hub, nil, "127.0.0.1")
+	hub.clients.Reserve(client.remoteIP)
+	hub.clients.Add(client)
+	
+	first := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", Velocity: types.Float64(200)}
+	second := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", Velocity: types.Float64(210)}
+	hub.enqueue([]types.FlightEvent{{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &first}})
+	hub.enqueue([]types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &second},
+		{Type: types.FlightUpdated, ICAO24: "4ca2b6", Flight: &types.Flight{ICAO24: "4ca2b6"}},
+		{Type: types.FlightRemoved, ICAO24: "4ca2b6"},
+	})
+	hub.flush(time.Now())
+	
+	var message Message
+	json.Unmarshal(<-client.send, &message)
+	if len(message.Changes) != 1 || string(message.Changes[0]["velocity"]) != "210" {
+		t.Errorf("Expected only the latest state of 3c6444, got %+v", message.Changes)
+	}
+	if len(message.Removed) != 1 || message.Removed[0] != "4ca2b6" {
+		t.Errorf("Expected 4ca2b6 to be removed, got %v", message.Removed)
+	}
+	
+	hub.flush(time.Now())
+	if len(client.send) != 0 {
+		t.Error("Expected nothing to be sent without pending updates")
+	}
+}
+
+func TestHub_ExpiresAircraftNotSeenWithinTTL(t *testing.T) {
+	hub := NewHub(time.Minute, 5*time.Minute, NewRegistry(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_connections"}), 0, 0))
+	client := newClient(hub, nil, "127.0.0.1")
+	hub.clients.Reserve(client.remoteIP)
+	hub.clients.Add(client)
+	
+	now := time.Unix(1700000000, 0)
+	quiet := types.Flight{ICAO24: "3c6444", LastContact: now.Add(-time.Minute)}
+	active := types.Flight{ICAO24: "4ca2b6", LastContact: now}
+	hub.enqueue([]types.FlightEvent{
+		{Type: types.FlightUpdated, ICAO24: quiet.ICAO24, Flight: &quiet},
+		{Type: types.FlightUpdated, ICAO24: active.ICAO24, Flight: &active},
+	})
+	hub.flush(now)
+	
+	var message Message
+	json.Unmarshal(<-client.send, &message)
+	if icao24s(message.Changes) != "3c6444,4ca2b6" || len(message.Removed) != 0 {
+		t.Fatalf("Expected both aircraft, got %+v", message)
+	}
+	
+	// Nothing is published for 3c6444 again, as with mock-data-service,
+	// which never sends removals.
+	hub.flush(now.Add(4*time.Minute + 30*time.Second))
+	message = Message{}
+	json.Unmarshal(<-client.send, &message)
+	if len(message.Changes) != 0 || len(message.Removed) != 1 || message.Removed[0] != "3c6444" {
+		t.Errorf("Expected 3c6444 to be removed, got %+v", message)
+	}
+	if len(hub.state) != 1 {
+		t.Errorf("Expected only 4ca2b6 to be kept, got %d aircraft", len(hub.state))
+	}
+	
+	// A late update of an expired aircraft is dropped rather than sent.
+	stale := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", LastContact: now.Add(-time.Minute)}
+	hub.enqueue([]types.FlightEvent{{Type: types.FlightUpdated, ICAO24: stale.ICAO24, Flight: &stale}})
+	hub.flush(now.Add(4*time.Minute + 30*time.Second))
+	if len(client.send) != 0 || len(hub.state) != 1 {
+		t.Errorf("Expected the stale update to be ignored, got %d messages and %d aircraft", len(client.send), len(hub.state))
+	}
+	
+	hub.flush(now.Add(5*time.Minute + time.Second))
+	message = Message{}
+	json.Unmarshal(<-client.send, &message)
+	if len(message.Removed) != 1 || message.Removed[0] != "4ca2b6" || len(hub.state) != 0 {
+		t.Errorf("Expected 4ca2b6 to expire as well, got %+v", message)
+	}
+}
+
+func TestHub_RestartsFailedSource(t *testing.T) {
+	hub := NewHub(time.Millisecond, 0, NewRegistry(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_connections"}), 0, 0))
+	hub.backoff = client.NewBackoff(time.Millisecond, 10*time.Millisecond)
+	
+	var mu sync.Mutex
+	runs := 0
+	source := func(ctx context.Context, handle func([]types.FlightEvent)) error {
+		mu.Lock()
+		runs++
+		run := runs
+		mu.Unlock()
+		if run < 3 {
+			return fmt.Errorf("connection refused")
+		}
+		flight := types.Flight{ICAO24: "3c6444", LastContact: time.Now()}
+		handle([]types.FlightEvent{{Type: types.FlightUpdated, ICAO24: flight.ICAO24, Flight: &flight}})
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx, source)
+		close(done)
+	}()
+	
+	waitFor(t, "the restarted source to deliver", func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		_, ok := hub.state["3c6444"]
+		return ok
+	})
+	cancel()
+	<-done
+	
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 3 {
+		t.Errorf("Expected the source to run 3 times, got %d", runs)
+	}
+}
+
+func TestHub_DisconnectsSlowClients(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	ws, url := startService(t, &config.Config{}, updates)
+	
+	dial(t, url)
+	waitFor(t, "the client to register", func() bool { return ws.hub.Len() == 1 })
+	
+	// The client never reads, so once the socket buffers are full its
+	// writer blocks and its queue fills up.
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; ws.hub.Len() > 0 && time.Now().Before(deadline); i++ {
+		flight := types.Flight{ICAO24: "3c6444", Callsign: strings.Repeat("X", 64*1024) + strconv.Itoa(i)}
+		ws.hub.enqueue([]types.FlightEvent{{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &flight}})
+		ws.hub.flush(time.Now())
+	}
+	
+	waitFor(t, "the slow client to be dropped", func() bool { return ws.hub.Len() == 0 })
+}
+
+func TestRegistry_ConcurrentUse(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_active_connections"})
+	registry := NewRegistry(gauge, 0, 0)
+	hub := NewHub(time.Minute, 0, registry)
+	
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := newClient(hub, nil, "10.0.0.1")
+			if err := registry.Reserve(client.remoteIP); err != nil {
+				t.Errorf("Reserve returned error: %v", err)
+			}
+			registry.Add(client)
+			registry.Connections()
+			if i%2 == 0 {
+				registry.Remove(client)
+				if registry.Remove(client) {
+					t.Error("Expected a client to be removed only once")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	
+	if registry.Len() != 25 || testutil.ToFloat64(gauge) != 25 {
+		t.Errorf("Expected 25 connections and gauge, got %d and %v", registry.Len(), testutil.ToFloat64(gauge))
+	}
+}
+
+func TestWSService_ConnectionMetadata(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	ws, url := startService(t, &config.Config{}, updates)
+	
+	conn := dial(t, url)
+	waitFor(t, "the client to register", func() bool { return ws.hub.Len() == 1 })
+	
+	flight := types.Flight{ICAO24: "3c6444"}
+	updates <- []types.FlightEvent{{Type: types.FlightUpdated, ICAO24: "3c6444", Flight: &flight}}
+	readMessage(t, conn)
+	
+	var info ConnectionInfo
+	waitFor(t, "bytes sent to be counted", func() bool {
+		info = ws.hub.clients.Connections()[0]
+		return info.BytesSent > 0
+	})
+	if info.ID == "" || info.RemoteIP != "127.0.0.1" || info.Subscription != subscriptionAll {
+		t.Errorf("Expected connection metadata, got %+v", info)
+	}
+	if time.Since(info.ConnectedAt) > time.Minute {
+		t.Errorf("Expected a recent connect time, got %v", info.ConnectedAt)
+	}
+	
+	r := gin.New()
+	r.GET("/ws-metrics", ws.GetMetrics)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ws-metrics", nil)
+	r.ServeHTTP(w, req)
+	
+	var body struct {
+		Connections int              `json:"connections"`
+		Clients     []ConnectionInfo `json:"clients"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Connections != 1 || len(body.Clients) != 1 || body.Clients[0].ID != info.ID {
+		t.Errorf("Expected the connection to be listed, got %s", w.Body.String())
+	}
+}
+
+func TestRegistry_Caps(t *testing.T) {
+	registry := NewRegistry(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_connections"}), 3, 2)
+	
+	for _, ip := range []string{"10.0.0.1", "10.0.0.1"} {
+		if err := registry.Reserve(ip); err != nil {
+			t.Fatalf("Reserve returned error: %v", err)
+		}
+	}
+	if err := registry.Reserve("10.0.0.1"); err != ErrTooManyFromIP {
+		t.Errorf("Expected ErrTooManyFromIP, got %v", err)
+	}
+	if err := registry.Reserve("10.0.0.2"); err != nil {
+		t.Fatalf("Reserve returned error: %v", err)
+	}
+	if err := registry.Reserve("10.0.0.3"); err != ErrTooManyConnections {
+		t.Errorf("Expected ErrTooManyConnections, got %v", err)
+	}
+	
+	registry.Release("10.0.0.1")
+	if err := registry.Reserve("10.0.0.1"); err != nil {
+		t.Errorf("Expected a released slot to be reusable, got %v", err)
+	}
+}
+
+func TestWSService_RejectsUpgradesOverCaps(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	ws, url := startService(t, &config.Config{MaxConnections: 3, MaxConnectionsPerIP: 2, TrustedProxies: []string{"127.0.0.1"}}, updates)
+	perIP := testutil.ToFloat64(observability.WebSocketRejectedUpgrades.WithLabelValues("max_connections_per_ip"))
+	total := testutil.ToFloat64(observability.WebSocketRejectedUpgrades.WithLabelValues("max_connections"))
+	
+	first := dial(t, url)
+	dial(t, url)
+	
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After for a third connection from one IP, got %v", resp)
+	}
+	
+	// Another address, as seen through the gateway.
+	header := http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+	if conn, _, err := websocket.DefaultDialer.Dial(url, header); err != nil {
+		t.Fatalf("Expected a connection from another IP, got %v", err)
+	} else {
+		defer conn.Close()
+	}
+	
+	header = http.Header{"X-Forwarded-For": {"203.0.113.8"}}
+	_, resp, err = websocket.DefaultDialer.Dial(url, header)
+	if err == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "30" {
+		t.Fatalf("Expected 503 with Retry-After once the global cap is reached, got %v", resp)
+	}
+	
+	if got := testutil.ToFloat64(observability.WebSocketRejectedUpgrades.WithLabelValues("max_connections_per_ip")) - perIP; got != 1 {
+		t.Errorf("Expected 1 rejection by the per-IP cap, got %v", got)
+	}
+	if got := testutil.ToFloat64(observability.WebSocketRejectedUpgrades.WithLabelValues("max_connections")) - total; got != 1 {
+		t.Errorf("Expected 1 rejection by the global cap, got %v", got)
+	}
+	
+	first.Close()
+	waitFor(t, "the slot to be freed", func() bool { return ws.hub.Len() == 2 })
+	if conn, _, err := websocket.DefaultDialer.Dial(url, nil); err != nil {
+		t.Errorf("Expected a freed slot to accept a connection, got %v", err)
+	} else {
+		conn.Close()
+	}
+}
+
+func TestWSService_IgnoresSpoofedForwardedFor(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	_, url := startService(t, &config.Config{MaxConnectionsPerIP: 1}, updates)
+	
+	// Without trusted proxies a client is counted by its own address,
+	// whatever it claims to forward for.
+	dial(t, url)
+	header := http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected a spoofed X-Forwarded-For to be ignored, got %v", resp)
+	}
+	
+	// Behind the gateway, the address it appends is used rather than one
+	// the client put in front of it.
+	_, url = startService(t, &config.Config{MaxConnectionsPerIP: 1, TrustedProxies: []string{"127.0.0.1"}}, updates)
+	dial(t, url, "198.51.100.1")
+	header = http.Header{"X-Forwarded-For": {"203.0.113.7, 198.51.100.1"}}
+	_, resp, err = websocket.DefaultDialer.Dial(url, header)
+	if err == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected a spoofed hop to be ignored behind the gateway, got %v", resp)
+	}
+	dial(t, url, "198.51.100.2")
+}
+
+// at returns an update placing an aircraft at the given position.
+func at(icao24 string, lat, lon float64) types.FlightEvent {
+	flight := types.Flight{ICAO24: icao24, Latitude: types.Float64(lat), Longitude: types.Float64(lon), BaroAltitude: types.Float64(10000)}
+	return types.FlightEvent{Type: types.FlightUpdated, ICAO24: icao24, Flight: &flight}
+}
+
+// icao24s returns the aircraft changed by diffs, joined by commas.
+func icao24s(diffs []FlightDiff) string {
+	ids := make([]string, len(diffs))
+	for i, diff := range diffs {
+		json.Unmarshal(diff["icao24"], &ids[i])
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestHub_SubscriptionsAndViewport(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	_, url := startService(t, &config.Config{}, updates)
+	conn := dial(t, url)
+	readMessage(t, conn)
+	
+	// Munich and Dublin are known before the client subscribes.
+	updates <- []types.FlightEvent{at("3c6444", 48.35, 11.78), at("4ca2b6", 53.42, -6.27)}
+	if message := readMessage(t, conn); len(message.Changes) != 2 {
+		t.Fatalf("Expected every aircraft before subscribing, got %+v", message)
+	}
+	
+	germany := geo.BBox{MinLat: 47, MinLon: 5, MaxLat: 55, MaxLon: 15}
+	conn.WriteJSON(ControlMessage{Type: ControlSubscribe, Filter: &SubscriptionFilter{BBox: &germany}})
+	if ack := readMessage(t, conn); ack.Type != MessageSubscribed || ack.Filter == nil || ack.Filter.BBox == nil {
+		t.Fatalf("Expected the subscription to be acknowledged, got %+v", ack)
+	}
+	if message := readMessage(t, conn); len(message.Changes) != 0 || len(message.Left) != 1 || message.Left[0] != "4ca2b6" {
+		t.Fatalf("Expected Dublin to leave the view, got %+v", message)
+	}
+	
+	// Only aircraft in the viewport are sent, and one flying out of it leaves.
+	updates <- []types.FlightEvent{at("3c6444", 48.40, 11.80), at("4ca2b6", 53.43, -6.25), at("3c4b26", 52.36, 13.50)}
+	if message := readMessage(t, conn); icao24s(message.Changes) != "3c4b26,3c6444" {
+		t.Fatalf("Expected Berlin and Munich, got %v", icao24s(message.Changes))
+	}
+	updates <- []types.FlightEvent{at("3c6444", 46.50, 11.90)}
+	if message := readMessage(t, conn); len(message.Changes) != 0 || len(message.Left) != 1 || message.Left[0] != "3c6444" {
+		t.Fatalf("Expected 3c6444 to leave the viewport, got %+v", message)
+	}
+	
+	// Panning to Ireland brings Dublin in and takes Berlin out.
+	ireland := geo.BBox{MinLat: 51, MinLon: -11, MaxLat: 56, MaxLon: -5}
+	conn.WriteJSON(ControlMessage{Type: ControlUpdateViewport, BBox: &ireland})
+	readMessage(t, conn)
+	if message := readMessage(t, conn); icao24s(message.Changes) != "4ca2b6" || len(message.Left) != 1 || message.Left[0] != "3c4b26" {
+		t.Fatalf("Expected Dublin in and Berlin out, got changes to %v left %v", icao24s(message.Changes), message.Left)
+	}
+	
+	updates <- []types.FlightEvent{{Type: types.FlightRemoved, ICAO24: "4ca2b6"}, {Type: types.FlightRemoved, ICAO24: "3c4b26"}}
+	if message := readMessage(t, conn); len(message.Removed) != 1 || message.Removed[0] != "4ca2b6" {
+		t.Fatalf("Expected only the visible aircraft to be removed, got %+v", message)
+	}
+	
+	conn.WriteJSON(ControlMessage{Type: ControlUnsubscribe})
+	if ack := readMessage(t, conn); ack.Type != MessageUnsubscribed {
+		t.Fatalf("Expected the unsubscription to be acknowledged, got %+v", ack)
+	}
+	updates <- []types.FlightEvent{at("4ca2b6", 53.42, -6.27)}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no updates after unsubscribing, got %s", data)
+	}
+}
+
+func TestHub_ControlErrors(t *testing.T) {
+	updates := make(chan []types.FlightEvent)
+	_, url := startService(t, &config.Config{}, updates)
+	conn := dial(t, url)
+	readMessage(t, conn)
+	
+	for _, control := range []string{
+		`{"type":"subscribe","filter":{"bbox":{"lamin":60,"lomin":0,"lamax":50,"lomax":10}}}`,
+		`{"type":"subscribe","filter":{"min_altitude":5000,"max_altitude":1000}}`,
+		`{"type":"teleport"}`,
+		`not json`,
+	} {
+		conn.WriteMessage(websocket.TextMessage, []byte(control))
+		if message := readMessage(t, conn); message.Type != MessageError || message.Error == "" {
+			t.Errorf("Expected an error for %s, got %+v", control, message)
+		}
+	}
+	
+	conn.WriteJSON(ControlMessage{Type: ControlUnsubscribe})
+	readMessage(t, conn)
+	conn.WriteJSON(ControlMessage{Type: ControlUpdateViewport, BBox: &geo.BBox{MinLat: 0, MinLon: 0, MaxLat: 1, MaxLon: 1}})
+	if message := readMessage(t, conn); message.Type != MessageError {
+		t.Errorf("Expected moving the viewport without a subscription to fail, got %+v", message)
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	filter, err := SubscriptionFilter{
+		ICAO24:        []string{"3C6444", "4ca2b6"},
+		Callsign:      "dlh",
+		OriginCountry: "Germany",
+		MinAltitude:   types.Float64(3000),
+		MaxAltitude:   types.Float64(12000),
+	}.Filter()
+	if err != nil {
+		t.Fatalf("Filter returned error: %v", err)
+	}
+	
+	flight := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", OriginCountry: "Germany", BaroAltitude: types.Float64(10000)}
+	if !filter.Match(flight) {
+		t.Error("Expected the flight to match every criterion")
+	}
+	
+	for name, modify := range map[string]func(*types.Flight){
+		"other aircraft": func(f *types.Flight) { f.ICAO24 = "3c6445" },
+		"other airline":  func(f *types.Flight) { f.Callsign = "EIN3LN" },
+		"other country":  func(f *types.Flight) { f.OriginCountry = "Ireland" },
+		"below the band": func(f *types.Flight) { f.BaroAltitude = types.Float64(1000) },
+		"above the band": func(f *types.Flight) { f.BaroAltitude = types.Float64(13000) },
+	} {
+		other := flight
+		modify(&other)
+		if filter.Match(other) {
+			t.Errorf("%s: expected the flight not to match", name)
+		}
+	}
+}
+
+func TestDiffFlight(t *testing.T) {
+	before := types.Flight{ICAO24: "3c6444", Callsign: "DLH4AB", Latitude: types.Float64(48.35), Longitude: types.Float64(11.78), Velocity: types.Float64(200), Sensors: []int{1, 2}}
+	after := before
+	after.Latitude = types.Float64(48.4)
+	after.Velocity = nil
+	after.Sensors = nil
+	
+	diff := diffFlight(&before, after)
+	want := FlightDiff{"icao24": json.RawMessage(`"3c6444"`), "latitude": json.RawMessage("48.4"), "velocity": jsonNull, "sensors": jsonNull}
+	if len(diff) != len(want) {
+		t.Fatalf("Expected only the changed fields, got %v", diff)
+	}
+	for field, value := range want {
+		if string(diff[field]) != string(value) {
+			t.Errorf("Expected %s to be %s, got %s", field, value, diff[field])
+		}
+	}
+	
+	if diff := diffFlight(&before, before); diff != nil {
+		t.Errorf("Expected no diff for an unchanged flight, got %v", diff)
+	}
+	if full := diffFlight(nil, after); string(full["callsign"]) != `"DLH4AB"` || string(full["velocity"]) != "null" {
+		t.Errorf("Expected every field for a new flight, got %v", full)
+	}
+}
+
+// replica is the state a client rebuilds from its snapshots and diffs.
+type replica struct {
+	conn    *websocket.Conn
+	seq     uint64
+	flights map[string]types.Flight
+}
+
+// apply applies a snapshot or diff, failing if one was missed.
+func (r *replica) apply(message Message) error {
+	if message.Seq != r.seq+1 && message.Type != MessageSnapshot {
+		return fmt.Errorf("expected seq %d, got %d", r.seq+1, message.Seq)
+	}
+	r.seq = message.Seq
+	
+	if message.Type == MessageSnapshot {
+		r.flights = make(map[string]types.Flight)
+		for _, flight := range message.Flights {
+			r.flights[flight.ICAO24] = flight
+		}
+		return nil
+	}
+	for _, diff := range message.Changes {
+		var icao24 string
+		json.Unmarshal(diff["icao24"], &icao24)
+		fields := FlightDiff{}
+		if flight, ok := r.flights[icao24]; ok {
+			data, _ := json.Marshal(flight)
+			json.Unmarshal(data, &fields)
+		}
+		for field, value := range diff {
+			fields[field] = value
+		}
+		data, _ := json.Marshal(fields)
+		var flight types.Flight
+		if err := json.Unmarshal(data, &flight); err != nil {
+			return err
+		}
+		r.flights[icao24] = flight
+	}
+	for _, icao24 := range append(message.Removed, message.Left...) {
+		delete(r.flights, icao24)
+	}
+	return nil
+}
+
+// sync subscribes with spec and applies every message up to the
+// acknowledgement, which is queued after the diffs already sent.
+func (r *replica) sync(t *testing.T, spec SubscriptionFilter) {
+	r.conn.WriteJSON(ControlMessage{Type: ControlSubscribe, Filter: &spec})
+	for {
+		message := readMessage(t, r.conn)
+		if message.Type == MessageSubscribed {
+			return
+		}
+		if err := r.apply(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// check compares the replica with the flights of the hub matching filter.
+func (r *replica) check(t *testing.T, hub *Hub, filter query.Filter) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	want := 0
+	for icao24, flight := range hub.state {
+		if !filter.Match(flight) {
+			continue
+		}
+		want++
+		expected, _ := json.Marshal(flight)
+		got, _ := json.Marshal(r.flights[icao24])
+		if string(got) != string(expected) {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	}
+	if len(r.flights) != want {
+		t.Errorf("Expected %d flights, got %d", want, len(r.flights))
+	}
+}
+
+// randomEvents changes, clears or removes some of the aircraft in flights.
+func randomEvents(rng *rand.Rand, flights map[string]types.Flight, round int) []types.FlightEvent {
+	var events []types.FlightEvent
+	for i := 0; i < 8; i++ {
+		icao24 := fmt.Sprintf("3c64%02x", rng.Intn(24))
+		if rng.Intn(8) == 0 {
+			delete(flights, icao24)
+			events = append(events, types.FlightEvent{Type: types.FlightRemoved, ICAO24: icao24})
+			continue
+		}
+		
+		flight, ok := flights[icao24]
+		if !ok {
+			flight = types.Flight{ICAO24: icao24, OriginCountry: "Germany"}
+		}
+		flight.LastContact = time.Unix(1700000000+int64(round), 0).UTC()
+		flight.Latitude = types.Float64(45 + rng.Float64()*10)
+		flight.Longitude = types.Float64(rng.Float64() * 20)
+		switch rng.Intn(4) {
+		case 0:
+			flight.Callsign = fmt.Sprintf("DLH%d", rng.Intn(100))
+			flight.Sensors = []int{rng.Intn(10)}
+		case 1:
+			flight.Velocity, flight.BaroAltitude, flight.Sensors = nil, nil, nil
+		case 2:
+			flight.Velocity = types.Float64(rng.Float64() * 300)
+			flight.BaroAltitude = types.Float64(rng.Float64() * 12000)
+		case 3:
+			flight.OnGround = !flight.OnGround
+			flight.TimePosition = types.Time(flight.LastContact)
+		}
+		flights[icao24] = flight
+		copied := flight
+		events = append(events, types.FlightEvent{Type: types.FlightUpdated, ICAO24: icao24, Flight: &copied})
+	}
+	return events
+}
+
+func TestHub_DiffsReproduceServerState(t *testing.T) {
+	ws, url := startService(t, &config.Config{BroadcastInterval: time.Hour}, make(chan []types.FlightEvent))
+	everything := &replica{conn: dial(t, url)}
+	viewport := &replica{conn: dial(t, url)}
+	for _, r := range []*replica{everything, viewport} {
+		if err := r.apply(readMessage(t, r.conn)); err != nil || r.seq != 1 {
+			t.Fatalf("Expected a snapshot first, got seq %d: %v", r.seq, err)
+		}
+	}
+	
+	south := SubscriptionFilter{BBox: &geo.BBox{MinLat: 45, MinLon: 0, MaxLat: 50, MaxLon: 10}}
+	north := SubscriptionFilter{BBox: &geo.BBox{MinLat: 50, MinLon: 5, MaxLat: 55, MaxLon: 20}}
+	spec := south
+	viewport.sync(t, spec)
+	
+	rng := rand.New(rand.NewSource(1))
+	flights := make(map[string]types.Flight)
+	for round := 1; round <= 60; round++ {
+		ws.hub.enqueue(randomEvents(rng, flights, round))
+		ws.hub.flush(time.Now())
+		if round%10 != 0 {
+			continue
+		}
+		
+		everything.sync(t, SubscriptionFilter{})
+		everything.check(t, ws.hub, query.Filter{})
+		viewport.sync(t, spec)
+		filter, _ := spec.Filter()
+		viewport.check(t, ws.hub, filter)
+		
+		// Moving the viewport is acknowledged before the aircraft that
+		// entered and left it, so they are applied by a second sync.
+		if round == 30 {
+			spec = north
+			viewport.sync(t, spec)
+			viewport.sync(t, spec)
+			filter, _ := spec.Filter()
+			viewport.check(t, ws.hub, filter)
+		}
+	}
+}
+
+func TestHub_ResyncAfterGap(t *testing.T) {
+	ws, url := startService(t, &config.Config{BroadcastInterval: time.Hour}, make(chan []types.FlightEvent))
+	r := &replica{conn: dial(t, url)}
+	r.apply(readMessage(t, r.conn))
+	
+	rng := rand.New(rand.NewSource(2))
+	flights := make(map[string]types.Flight)
+	ws.hub.enqueue(randomEvents(rng, flights, 1))
+	ws.hub.flush(time.Now())
+	readMessage(t, r.conn)
+	ws.hub.enqueue(randomEvents(rng, flights, 2))
+	ws.hub.flush(time.Now())
+	if err := r.apply(readMessage(t, r.conn)); err == nil {
+		t.Fatal("Expected the missed diff to be detected")
+	}
+	
+	r.conn.WriteJSON(ControlMessage{Type: ControlResync})
+	snapshot := readMessage(t, r.conn)
+	if snapshot.Type != MessageSnapshot || snapshot.Seq != 4 {
+		t.Fatalf("Expected a snapshot numbered 4, got %+v", snapshot)
+	}
+	r.apply(snapshot)
+	r.check(t, ws.hub, query.Filter{})
+	
+	ws.hub.enqueue(randomEvents(rng, flights, 3))
+	ws.hub.flush(time.Now())
+	if err := r.apply(readMessage(t, r.conn)); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, ws.hub, query.Filter{})
+}